@@ -0,0 +1,396 @@
+package main
+
+import (
+	"chirpy/internal/api"
+	"chirpy/internal/config"
+	"chirpy/internal/database"
+	"chirpy/internal/jobs"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const usage = `usage: chirpy <command> [flags]
+
+commands:
+  serve                                 start the HTTP server (the default)
+  migrate up|down|status|redo           manage the database schema
+  user create -email E -password P [-handle H] [-admin]
+  user promote|upgrade|disable -user EMAIL_OR_ID
+  tokens revoke -user EMAIL_OR_ID       sign a user out everywhere
+  chirps purge [-older-than DURATION]   hard-delete soft-deleted rows now
+  seed                                  fill a dev database with sample data
+
+Every command also takes -config, -platform, -addr and -db-url.`
+
+// run dispatches to the command named by args[0]. Flags without a command
+// start the server, like before there were commands.
+func run(logger *zap.SugaredLogger, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(logger, args)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		return runServe(logger, args)
+	case "migrate":
+		return runMigrate(logger, args)
+	case "user":
+		return runUser(args)
+	case "tokens":
+		return runTokens(args)
+	case "chirps":
+		return runChirps(logger, args)
+	case "seed":
+		return runSeed(args)
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q\n%s", command, usage)
+}
+
+// subcommand splits "<verb> [flags]", so commands with several verbs can
+// share their flag parsing.
+func subcommand(args []string, verbs ...string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("expected one of %s\n%s", strings.Join(verbs, ", "), usage)
+	}
+	for _, verb := range verbs {
+		if args[0] == verb {
+			return verb, args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("unknown command %q, expected one of %s", args[0], strings.Join(verbs, ", "))
+}
+
+// connect loads the configuration once fs has been parsed and opens the
+// database it points at.
+func connect(flags *config.Flags) (config.Config, *sql.DB, *database.Queries, error) {
+	conf, err := flags.LoadCLI()
+	if err != nil {
+		return config.Config{}, nil, nil, fmt.Errorf("loading configuration: %w", err)
+	}
+	db, err := openDB(conf.Database)
+	if err != nil {
+		return config.Config{}, nil, nil, err
+	}
+	return conf, db, database.New(db), nil
+}
+
+// findUser looks a user up by id or, failing that, by email.
+func findUser(ctx context.Context, queries *database.Queries, ref string) (database.User, error) {
+	if ref == "" {
+		return database.User{}, errors.New("-user is required")
+	}
+	var user database.User
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = queries.FindUserById(ctx, id)
+	} else {
+		user, err = queries.FindUserByEmail(ctx, ref)
+	}
+	if err == sql.ErrNoRows {
+		return database.User{}, fmt.Errorf("no user %q", ref)
+	}
+	return user, err
+}
+
+func runUser(args []string) error {
+	verb, args, err := subcommand(args, "create", "promote", "upgrade", "disable")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("user "+verb, flag.ContinueOnError)
+	flags := config.NewFlags(fs)
+	userRef := fs.String("user", "", "email or id of the user")
+	email := fs.String("email", "", "email of the new user")
+	password := fs.String("password", "", "password of the new user")
+	handle := fs.String("handle", "", "handle of the new user, generated when empty")
+	admin := fs.Bool("admin", false, "give the new user the admin role")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conf, db, queries, err := connect(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if verb == "create" {
+		if *email == "" || *password == "" {
+			return errors.New("-email and -password are required")
+		}
+		*handle = strings.ToLower(*handle)
+		if *handle == "" {
+			*handle = api.DefaultHandle()
+		}
+		if fields := api.ValidateProfile(*handle, "", "", ""); len(fields) > 0 {
+			messages := []string{}
+			for _, f := range fields {
+				messages = append(messages, f.Message)
+			}
+			return fmt.Errorf("invalid profile: %s", strings.Join(messages, "; "))
+		}
+		// the same policy as signing up through the API, admins included
+		policy, err := passwordPolicy(conf.Auth.Password)
+		if err != nil {
+			return err
+		}
+		violations, err := policy.Check(ctx, *password, *email, *handle)
+		if err != nil {
+			return fmt.Errorf("checking password: %w", err)
+		}
+		if len(violations) > 0 {
+			messages := []string{}
+			for _, v := range violations {
+				messages = append(messages, v.Message)
+			}
+			return fmt.Errorf("password rejected: %s", strings.Join(messages, "; "))
+		}
+		hashedPassword, err := passwordHasher(conf.Auth.Password).Hash(*password)
+		if err != nil {
+			return fmt.Errorf("hashing password: %w", err)
+		}
+		user, err := queries.CreateUser(ctx, database.CreateUserParams{
+			Email:          *email,
+			HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+			Handle:         *handle,
+		})
+		if err != nil {
+			return fmt.Errorf("creating user: %w", err)
+		}
+		if *admin {
+			if _, err := queries.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: api.RoleAdmin}); err != nil {
+				return fmt.Errorf("promoting user: %w", err)
+			}
+		}
+		err = api.AuditCLI(ctx, queries, api.AuditUserCreate, user.ID, "",
+			map[string]string{"admin": strconv.FormatBool(*admin)})
+		if err != nil {
+			return fmt.Errorf("recording audit event: %w", err)
+		}
+		fmt.Printf("created user %s (%s, @%s)\n", user.ID, user.Email, user.Handle)
+		return nil
+	}
+
+	user, err := findUser(ctx, queries, *userRef)
+	if err != nil {
+		return err
+	}
+
+	switch verb {
+	case "promote":
+		if _, err := queries.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: api.RoleAdmin}); err != nil {
+			return fmt.Errorf("promoting user: %w", err)
+		}
+		if err := api.AuditCLI(ctx, queries, api.AuditUserPromote, user.ID, "", nil); err != nil {
+			return fmt.Errorf("recording audit event: %w", err)
+		}
+		fmt.Printf("%s is now an admin\n", user.Email)
+	case "upgrade":
+		if _, err := queries.UpgradeUser(ctx, user.ID); err != nil {
+			return fmt.Errorf("upgrading user: %w", err)
+		}
+		if err := api.AuditCLI(ctx, queries, api.AuditUpgrade, user.ID, "", nil); err != nil {
+			return fmt.Errorf("recording audit event: %w", err)
+		}
+		fmt.Printf("%s is now Chirpy Red\n", user.Email)
+	case "disable":
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("beginning transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		q := queries.InTx(tx)
+		if _, err := q.DisableUser(ctx, user.ID); err != nil {
+			return fmt.Errorf("disabling user: %w", err)
+		}
+		if err := q.RevokeAllRefreshTokensForUser(ctx, uuid.NullUUID{UUID: user.ID, Valid: true}); err != nil {
+			return fmt.Errorf("revoking refresh tokens: %w", err)
+		}
+		if err := q.RevokeAllPersonalAccessTokensForUser(ctx, user.ID); err != nil {
+			return fmt.Errorf("revoking personal access tokens: %w", err)
+		}
+		if err := api.AuditCLI(ctx, q, api.AuditUserDisable, user.ID, "", nil); err != nil {
+			return fmt.Errorf("recording audit event: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing: %w", err)
+		}
+		fmt.Printf("%s is disabled and signed out\n", user.Email)
+	}
+	return nil
+}
+
+func runTokens(args []string) error {
+	_, args, err := subcommand(args, "revoke")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("tokens revoke", flag.ContinueOnError)
+	flags := config.NewFlags(fs)
+	userRef := fs.String("user", "", "email or id of the user")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, db, queries, err := connect(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	user, err := findUser(ctx, queries, *userRef)
+	if err != nil {
+		return err
+	}
+	if err := queries.RevokeAllRefreshTokensForUser(ctx, uuid.NullUUID{UUID: user.ID, Valid: true}); err != nil {
+		return fmt.Errorf("revoking refresh tokens: %w", err)
+	}
+	if err := queries.RevokeAllPersonalAccessTokensForUser(ctx, user.ID); err != nil {
+		return fmt.Errorf("revoking personal access tokens: %w", err)
+	}
+	if err := api.AuditCLI(ctx, queries, api.AuditTokensRevoke, user.ID, "", nil); err != nil {
+		return fmt.Errorf("recording audit event: %w", err)
+	}
+	fmt.Printf("revoked every refresh and personal access token of %s\n", user.Email)
+	return nil
+}
+
+func runChirps(logger *zap.SugaredLogger, args []string) error {
+	_, args, err := subcommand(args, "purge")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("chirps purge", flag.ContinueOnError)
+	flags := config.NewFlags(fs)
+	olderThan := fs.Duration("older-than", 0, "purge rows deleted longer ago than this (default: the configured retention)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conf, db, queries, err := connect(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	retention := conf.Chirps.Retention
+	if *olderThan > 0 {
+		retention = *olderThan
+	}
+	chirps, users, err := jobs.NewPurger(logger, queries, 0, retention).Purge(ctx)
+	if err != nil {
+		return fmt.Errorf("purging: %w", err)
+	}
+	err = api.AuditCLI(ctx, queries, api.AuditPurge, uuid.Nil, "", map[string]string{
+		"chirps":     strconv.FormatInt(chirps, 10),
+		"users":      strconv.FormatInt(users, 10),
+		"older_than": retention.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("recording audit event: %w", err)
+	}
+	fmt.Printf("purged %d chirps and %d users deleted more than %s ago\n", chirps, users, retention)
+	return nil
+}
+
+var seedChirps = []string{
+	"Hello chirpy!",
+	"Scheduling my next chirp from the CLI",
+	"Check out https://go.dev for all things Go",
+}
+
+// runSeed creates a few users with chirps. It refuses to touch anything but
+// a dev database and skips users that already exist, so it can be rerun.
+// The users share a password made up for the run: a fixed one would be a
+// known credential on any dev database exposed by mistake.
+func runSeed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags := config.NewFlags(fs)
+	users := fs.Int("users", 3, "number of users to create")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conf, db, queries, err := connect(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if conf.Platform != "dev" {
+		return errors.New("seed only runs with the dev platform")
+	}
+	ctx := context.Background()
+
+	password, err := seedPassword()
+	if err != nil {
+		return fmt.Errorf("generating password: %w", err)
+	}
+	hashedPassword, err := passwordHasher(conf.Auth.Password).Hash(password)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+
+	for n := 1; n <= *users; n++ {
+		email := fmt.Sprintf("seed%d@example.com", n)
+		if _, err := queries.FindUserByEmail(ctx, email); err == nil {
+			fmt.Printf("skipping %s, it already exists\n", email)
+			continue
+		} else if err != sql.ErrNoRows {
+			return fmt.Errorf("finding user: %w", err)
+		}
+
+		user, err := queries.CreateUser(ctx, database.CreateUserParams{
+			Email:          email,
+			HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+			Handle:         fmt.Sprintf("seed_%d", n),
+			DisplayName:    fmt.Sprintf("Seed User %d", n),
+		})
+		if err != nil {
+			return fmt.Errorf("creating user: %w", err)
+		}
+
+		now := time.Now().UTC()
+		for _, body := range seedChirps {
+			_, err := queries.CreateChirp(ctx, database.CreateChirpParams{
+				Body:        body,
+				UserID:      uuid.NullUUID{UUID: user.ID, Valid: true},
+				PublishedAt: sql.NullTime{Time: now, Valid: true},
+			})
+			if err != nil {
+				return fmt.Errorf("creating chirp: %w", err)
+			}
+		}
+		fmt.Printf("created %s with %d chirps (password: %s)\n", email, len(seedChirps), password)
+	}
+	return nil
+}
+
+func seedPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
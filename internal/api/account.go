@@ -0,0 +1,530 @@
+package api
+
+import (
+	"bytes"
+	"chirpy/internal/auth"
+	"chirpy/internal/authz"
+	"chirpy/internal/database"
+	"chirpy/internal/mail"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// emailChangeTTL is how long the confirmation link for a new email address
+// stays valid.
+const emailChangeTTL = 24 * time.Hour
+
+// UpdateCurrentUser changes the public profile. Only the fields present in
+// the body are touched; email and password have their own endpoints.
+func (cfg *Config) UpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanEditProfile(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+
+	type parameters struct {
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		AvatarUrl   *string `json:"avatar_url"`
+	}
+
+	params := parameters{}
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
+		return
+	}
+
+	user, err := cfg.DbQueries.FindUserById(r.Context(), principal.UserID)
+	if err != nil {
+		logger.Errorw("finding user by id", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	update := database.UpdateUserProfileParams{
+		ID:          user.ID,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
+	}
+	if params.Handle != nil {
+		update.Handle = strings.ToLower(*params.Handle)
+	}
+	if params.DisplayName != nil {
+		update.DisplayName = *params.DisplayName
+	}
+	if params.Bio != nil {
+		update.Bio = *params.Bio
+	}
+	if params.AvatarUrl != nil {
+		update.AvatarUrl = *params.AvatarUrl
+	}
+	if fields := ValidateProfile(update.Handle, update.DisplayName, update.Bio, update.AvatarUrl); len(fields) > 0 {
+		respondError(w, r, errValidation(fields...))
+		return
+	}
+
+	updated, err := cfg.DbQueries.UpdateUserProfile(r.Context(), update)
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(w, r, newError(http.StatusConflict, CodeConflict, "handle is already taken"))
+			return
+		}
+		logger.Errorw("updating user profile", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	response := struct {
+		Id          string `json:"id"`
+		CreatedAt   string `json:"created_at"`
+		UpdatedAt   string `json:"updated_at"`
+		Email       string `json:"email"`
+		IsChirpyRed bool   `json:"is_chirpy_red"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarUrl   string `json:"avatar_url"`
+	}{
+		Id:          updated.ID.String(),
+		CreatedAt:   updated.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:   updated.UpdatedAt.UTC().Format(time.RFC3339),
+		Email:       updated.Email,
+		IsChirpyRed: updated.IsChirpyRed,
+		Handle:      updated.Handle,
+		DisplayName: updated.DisplayName,
+		Bio:         updated.Bio,
+		AvatarUrl:   updated.AvatarUrl,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ChangePassword replaces the password after checking the current one. Users
+// who signed up through an identity provider set their first password here,
+// confirmed by a recent sign-in instead. Every refresh token and personal
+// access token of the user is revoked, signing out other devices and bots,
+// and the caller gets a fresh session in the response.
+func (cfg *Config) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password" validate:"required"`
+	}
+
+	params := parameters{}
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
+		return
+	}
+
+	user, err := cfg.DbQueries.FindUserById(r.Context(), principal.UserID)
+	if err != nil {
+		logger.Errorw("finding user by id", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	if reason, apiErr := cfg.confirmIdentity(r, principal, user, "current_password", params.CurrentPassword); apiErr != nil {
+		cfg.audit(r, auditEvent{action: AuditPasswordChange, outcome: OutcomeFailure, actor: user.ID, subject: user.ID,
+			details: map[string]string{"reason": reason}})
+		respondError(w, r, apiErr)
+		return
+	}
+
+	fields, apiErr := cfg.checkPassword(r.Context(), params.NewPassword, user.Email, user.Handle)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	for i := range fields {
+		fields[i].Field = "new_password"
+	}
+	if len(fields) > 0 {
+		respondError(w, r, errValidation(fields...))
+		return
+	}
+
+	hashedPassword, err := cfg.Passwords.Hash(params.NewPassword)
+	if err != nil {
+		logger.Errorw("hashing password", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logger.Errorw("starting transaction", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	defer tx.Rollback()
+	q := cfg.DbQueries.InTx(tx)
+
+	err = q.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+	})
+	if err != nil {
+		logger.Errorw("updating password", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	err = q.RevokeAllRefreshTokensForUser(r.Context(), uuid.NullUUID{
+		UUID:  user.ID,
+		Valid: true,
+	})
+	if err != nil {
+		logger.Errorw("revoking refresh tokens", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if err := q.RevokeAllPersonalAccessTokensForUser(r.Context(), user.ID); err != nil {
+		logger.Errorw("revoking personal access tokens", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Errorw("committing password change", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	logger.Infow("password changed", "user_id", user.ID)
+	cfg.audit(r, auditEvent{action: AuditPasswordChange, outcome: OutcomeSuccess, actor: user.ID, subject: user.ID})
+
+	// keep the caller signed in the way they were
+	_, fromCookie, _ := cfg.requestToken(r, AccessCookie)
+	session, err := cfg.startSession(r.Context(), w, user.ID, fromCookie)
+	if err != nil {
+		logger.Errorw("starting session", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	respondLogin(w, user, session)
+}
+
+// usersPutDeprecatedAt is when PUT /api/users gave way to the /api/users/me
+// endpoints, as an RFC 9745 Deprecation header.
+const usersPutDeprecatedAt = "@1792281600"
+
+// UpdateUserLogin is the deprecated PUT /api/users, which used to set email
+// and password in one go. It stays for old clients as a thin layer over
+// ChangePassword, so the password now needs current_password like anywhere
+// else. The email can't change here any more: a new address has to be
+// confirmed through RequestEmailChange first.
+func (cfg *Config) UpdateUserLogin(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	w.Header().Set("Deprecation", usersPutDeprecatedAt)
+	w.Header().Add("Link", `</api/users/me/password>; rel="successor-version"`)
+	w.Header().Add("Link", `</api/users/me/email>; rel="successor-version"`)
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+
+	type parameters struct {
+		Email           string `json:"email" validate:"required,email,max=254"`
+		Password        string `json:"password" validate:"required"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	params := parameters{}
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
+		return
+	}
+
+	user, err := cfg.DbQueries.FindUserById(r.Context(), principal.UserID)
+	if err != nil {
+		logger.Errorw("finding user by id", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if !strings.EqualFold(params.Email, user.Email) {
+		respondError(w, r, errValidation(FieldError{Field: "email", Code: "unsupported",
+			Message: "email can't be changed here any more, use POST /api/users/me/email"}))
+		return
+	}
+
+	body, err := json.Marshal(struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}{
+		CurrentPassword: params.CurrentPassword,
+		NewPassword:     params.Password,
+	})
+	if err != nil {
+		logger.Errorw("encoding password change", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	forwarded := r.Clone(r.Context())
+	forwarded.Body = io.NopCloser(bytes.NewReader(body))
+	forwarded.ContentLength = int64(len(body))
+	cfg.ChangePassword(w, forwarded)
+}
+
+// RequestEmailChange starts moving the account to a new email address. The
+// address only changes once the link sent to it is confirmed, so a typo
+// can't lock the user out.
+func (cfg *Config) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+
+	type parameters struct {
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
+		return
+	}
+
+	user, err := cfg.DbQueries.FindUserById(r.Context(), principal.UserID)
+	if err != nil {
+		logger.Errorw("finding user by id", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if reason, apiErr := cfg.confirmIdentity(r, principal, user, "password", params.Password); apiErr != nil {
+		cfg.audit(r, auditEvent{action: AuditEmailChangeRequest, outcome: OutcomeFailure, actor: user.ID, subject: user.ID,
+			details: map[string]string{"reason": reason}})
+		respondError(w, r, apiErr)
+		return
+	}
+	if strings.EqualFold(params.Email, user.Email) {
+		respondError(w, r, errValidation(FieldError{Field: "email", Code: "unchanged", Message: "email is already your address"}))
+		return
+	}
+	if _, err := cfg.DbQueries.FindUserByEmail(r.Context(), params.Email); err != sql.ErrNoRows {
+		if err != nil {
+			logger.Errorw("searching user by email", "error", err)
+			respondError(w, r, errInternal())
+			return
+		}
+		respondError(w, r, newError(http.StatusConflict, CodeConflict, "email is already taken"))
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		logger.Errorw("creating email change token", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	// replaces any change still pending, invalidating its link
+	change, err := cfg.DbQueries.CreateEmailChange(r.Context(), database.CreateEmailChangeParams{
+		UserID:    user.ID,
+		NewEmail:  params.Email,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(emailChangeTTL).UTC(),
+	})
+	if err != nil {
+		logger.Errorw("storing email change", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	link := cfg.LinkBaseURL + "/app/?confirm_email=" + url.QueryEscape(token)
+	err = cfg.Mailer.Send(r.Context(), mail.Message{
+		To:      change.NewEmail,
+		Subject: "Confirm your new Chirpy email address",
+		Body: fmt.Sprintf("Someone, hopefully you, asked to move the Chirpy account @%s to this address.\n\n"+
+			"To confirm, open this link within 24 hours:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email and nothing will change.\n", user.Handle, link),
+	})
+	if err != nil {
+		logger.Errorw("sending email change confirmation", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	cfg.audit(r, auditEvent{action: AuditEmailChangeRequest, outcome: OutcomeSuccess, actor: user.ID, subject: user.ID,
+		details: map[string]string{"new_email": change.NewEmail}})
+
+	response := struct {
+		Email     string `json:"email"`
+		ExpiresAt string `json:"expires_at"`
+	}{
+		Email:     change.NewEmail,
+		ExpiresAt: change.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ConfirmEmailChange switches the account to the new address. Holding the
+// token proves control of that address, so no session is needed: the link
+// may well be opened on another device.
+func (cfg *Config) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	type parameters struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	params := parameters{}
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
+		return
+	}
+
+	change, err := cfg.DbQueries.FindEmailChangeByHash(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, r, errBadRequest("invalid or expired confirmation link"))
+			return
+		}
+		logger.Errorw("finding email change", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if time.Now().After(change.ExpiresAt) {
+		logger.Infow("email change expired", "user_id", change.UserID)
+		respondError(w, r, errBadRequest("invalid or expired confirmation link"))
+		return
+	}
+
+	oldEmail, user, err := cfg.applyEmailChange(r.Context(), change)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			respondError(w, r, newError(http.StatusConflict, CodeConflict, "email is already taken"))
+		case errors.Is(err, sql.ErrNoRows):
+			respondError(w, r, errBadRequest("invalid or expired confirmation link"))
+		default:
+			logger.Errorw("changing email", "error", err)
+			respondError(w, r, errInternal())
+		}
+		return
+	}
+	logger.Infow("email changed", "user_id", user.ID)
+	cfg.audit(r, auditEvent{action: AuditEmailChange, outcome: OutcomeSuccess, actor: user.ID, subject: user.ID,
+		details: map[string]string{"old_email": oldEmail, "new_email": user.Email}})
+
+	// tell the old address, in case the change wasn't the owner's doing
+	err = cfg.Mailer.Send(r.Context(), mail.Message{
+		To:      oldEmail,
+		Subject: "Your Chirpy email address was changed",
+		Body: fmt.Sprintf("The email address of the Chirpy account @%s was changed to %s.\n\n"+
+			"If you didn't do this, contact support right away.\n", user.Handle, user.Email),
+	})
+	if err != nil {
+		logger.Warnw("sending email change notice", "error", err)
+	}
+
+	response := struct {
+		Id          string `json:"id"`
+		CreatedAt   string `json:"created_at"`
+		UpdatedAt   string `json:"updated_at"`
+		Email       string `json:"email"`
+		IsChirpyRed bool   `json:"is_chirpy_red"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarUrl   string `json:"avatar_url"`
+	}{
+		Id:          user.ID.String(),
+		CreatedAt:   user.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:   user.UpdatedAt.UTC().Format(time.RFC3339),
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// applyEmailChange moves the user to the new address and uses up the change,
+// returning the address they had before.
+func (cfg *Config) applyEmailChange(ctx context.Context, change database.EmailChange) (string, database.UpdateUserEmailRow, error) {
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", database.UpdateUserEmailRow{}, err
+	}
+	defer tx.Rollback()
+	q := cfg.DbQueries.InTx(tx)
+
+	before, err := q.FindUserById(ctx, change.UserID)
+	if err != nil {
+		return "", database.UpdateUserEmailRow{}, err
+	}
+	user, err := q.UpdateUserEmail(ctx, database.UpdateUserEmailParams{
+		ID:    change.UserID,
+		Email: change.NewEmail,
+	})
+	if err != nil {
+		return "", database.UpdateUserEmailRow{}, err
+	}
+	if err := q.DeleteEmailChange(ctx, change.ID); err != nil {
+		return "", database.UpdateUserEmailRow{}, err
+	}
+	return before.Email, user, tx.Commit()
+}
@@ -1,26 +1,73 @@
 package api
 
 import (
-	"fmt"
+	"chirpy/internal/auth"
+	"chirpy/internal/authz"
+	"crypto/subtle"
 	"net/http"
 )
 
-func (cfg *Config) PageHits(w http.ResponseWriter, r *http.Request) {
-	resp := fmt.Sprintf(`<html>
-            <body>
-                <h1>Welcome, Chirpy Admin</h1>
-                <p>Chirpy has been visited %d times!</p>
-            </body>
-        </html>`, cfg.FileserverHits.Load())
-	w.Write([]byte(resp))
-}
+const (
+	RoleUser  = authz.RoleUser
+	RoleAdmin = authz.RoleAdmin
+)
+
+func (cfg *Config) ResetUsers(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
 
-func (cfg *Config) ResetHitsAndUsers(w http.ResponseWriter, r *http.Request) {
 	if cfg.Platform != "dev" {
-		w.WriteHeader(http.StatusForbidden)
+		respondError(w, r, errForbidden("reset is only allowed in the dev environment"))
 		return
 	}
-	cfg.DbQueries.DeleteAllUsers(r.Context())
-	cfg.FileserverHits.Swap(0)
+	// both are soft deletes; the purge job removes the rows for good once
+	// the retention period has passed
+	if err := cfg.DbQueries.DeleteAllChirps(r.Context()); err != nil {
+		logger.Errorw("deleting all chirps", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if err := cfg.DbQueries.DeleteAllUsers(r.Context()); err != nil {
+		logger.Errorw("deleting all users", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	cfg.audit(r, auditEvent{action: AuditAdminReset, outcome: OutcomeSuccess})
 	w.Write([]byte("OK"))
 }
+
+// RequireAdmin only lets through requests from users with the admin role, or
+// carrying the admin API key for automation. With no key configured only
+// admin users get in.
+func (cfg *Config) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := loggerFrom(r.Context())
+
+		if _, err := bearerToken(r); err == nil || (cfg.CookieSessions && hasSessionCookie(r)) {
+			principal, apiErr := cfg.authenticate(r)
+			if apiErr != nil {
+				respondError(w, r, apiErr)
+				return
+			}
+			if err := authz.CanAdminister(principal); err != nil {
+				logger.Warnw("non-admin user requested an admin endpoint", "user_id", principal.UserID, "error", err)
+				respondError(w, r, errDenied(err))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		apiKey, err := auth.GetAPIKey(r.Header)
+		if err != nil {
+			logger.Infow("extracting API Key", "error", err)
+			respondError(w, r, errUnauthorized("missing or invalid API key"))
+			return
+		}
+		if cfg.AdminKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.AdminKey)) != 1 {
+			logger.Warnw("api key doesn't match the admin api key")
+			respondError(w, r, errUnauthorized("missing or invalid API key"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
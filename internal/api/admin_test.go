@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdminAPIKey(t *testing.T) {
+	cfg := &Config{AdminKey: "admin-key"}
+	handler := cfg.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"admin key", "ApiKey admin-key", http.StatusNoContent},
+		{"wrong key", "ApiKey nope", http.StatusUnauthorized},
+		{"no header", "", http.StatusUnauthorized},
+		{"scheme without key", "ApiKey", http.StatusUnauthorized},
+		{"empty key", "ApiKey ", http.StatusUnauthorized},
+		{"scheme not a prefix", "xApiKey", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/health", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
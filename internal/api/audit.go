@@ -0,0 +1,359 @@
+package api
+
+import (
+	"chirpy/internal/authz"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit actions. They are stored, so existing ones must never be renamed.
+const (
+	AuditLogin              = "auth.login"
+	AuditRefresh            = "auth.refresh"
+	AuditRevoke             = "auth.revoke"
+	AuditTokenCreate        = "auth.token_create"
+	AuditTokenRevoke        = "auth.token_revoke"
+	AuditPasswordChange     = "account.password_change"
+	AuditEmailChangeRequest = "account.email_change_request"
+	AuditEmailChange        = "account.email_change"
+	AuditAccountDelete      = "account.delete"
+	AuditUpgrade            = "billing.upgrade"
+	AuditAdminReset         = "admin.reset"
+	AuditModeratorDelete    = "moderation.chirp_delete"
+	AuditUserCreate         = "admin.user_create"
+	AuditUserPromote        = "admin.user_promote"
+	AuditUserDisable        = "admin.user_disable"
+	AuditTokensRevoke       = "admin.tokens_revoke"
+	AuditPurge              = "admin.purge"
+)
+
+// ActorCLI is the actor recorded for the chirpy command line, which acts
+// with nobody signed in. See AuditCLI.
+const ActorCLI = "cli"
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+const (
+	defaultAuditPage = 50
+	maxAuditPage     = 200
+)
+
+// auditEvent is one entry for the audit trail. actor is who acted and
+// subject the account affected; either is uuid.Nil when there is none,
+// like a failed login for an unknown email or a webhook.
+type auditEvent struct {
+	action  string
+	outcome string
+	actor   uuid.UUID
+	subject uuid.UUID
+	target  string
+	details map[string]string
+}
+
+// audit appends e to the audit trail along with where the request came
+// from. Write failures are only logged: the action has already happened or
+// been refused, and the trail must not take the API down with it.
+func (cfg *Config) audit(r *http.Request, e auditEvent) {
+	logger := loggerFrom(r.Context())
+
+	details := []byte("{}")
+	if len(e.details) > 0 {
+		details, _ = json.Marshal(e.details)
+	}
+	err := cfg.DbQueries.CreateAuditEvent(r.Context(), database.CreateAuditEventParams{
+		Action:    e.action,
+		Outcome:   e.outcome,
+		ActorID:   uuid.NullUUID{UUID: e.actor, Valid: e.actor != uuid.Nil},
+		SubjectID: uuid.NullUUID{UUID: e.subject, Valid: e.subject != uuid.Nil},
+		Target:    e.target,
+		Ip:        cfg.clientIP(r),
+		UserAgent: truncateRunes(r.UserAgent(), 512),
+		RequestID: requestIDFrom(r.Context()),
+		Details:   string(details),
+	})
+	if err != nil {
+		logger.Errorw("writing audit event", "action", e.action, "error", err)
+	}
+}
+
+// AuditCLI appends an event for an administrative command to the audit
+// trail. There is no user behind a command, so the event has no actor_id;
+// its details name the cli as the actor along with the operating system
+// user who ran it. Unlike audit it returns failures, for the operator to
+// see.
+func AuditCLI(ctx context.Context, q *database.Queries, action string, subject uuid.UUID, target string, details map[string]string) error {
+	all := map[string]string{"actor": ActorCLI}
+	if u, err := user.Current(); err == nil {
+		all["os_user"] = u.Username
+	}
+	maps.Copy(all, details)
+	encoded, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return q.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		Action:    action,
+		Outcome:   OutcomeSuccess,
+		SubjectID: uuid.NullUUID{UUID: subject, Valid: subject != uuid.Nil},
+		Target:    target,
+		UserAgent: "chirpy-cli",
+		Details:   string(encoded),
+	})
+}
+
+// clientIP is the address the request came from. Behind reverse proxies
+// RemoteAddr is the nearest proxy, so X-Forwarded-For is walked from the
+// right past every TrustedProxies hop, and the first address outside them
+// is the client. Anyone can send the header, so it only counts when the
+// peer itself is trusted.
+func (cfg *Config) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !cfg.trustedProxy(peer) {
+		return host
+	}
+
+	hops := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// junk can't be trusted past; the last proxy is the best we know
+			break
+		}
+		host = hop.Unmap().String()
+		if !cfg.trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+func (cfg *Config) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type auditEventResponse struct {
+	Id        int64           `json:"id"`
+	CreatedAt string          `json:"created_at"`
+	Action    string          `json:"action"`
+	Outcome   string          `json:"outcome"`
+	ActorId   string          `json:"actor_id,omitempty"`
+	SubjectId string          `json:"subject_id,omitempty"`
+	Target    string          `json:"target,omitempty"`
+	Ip        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	RequestId string          `json:"request_id,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+}
+
+func newAuditEventResponse(event database.AuditEvent) auditEventResponse {
+	response := auditEventResponse{
+		Id:        event.ID,
+		CreatedAt: event.CreatedAt.UTC().Format(time.RFC3339),
+		Action:    event.Action,
+		Outcome:   event.Outcome,
+		Target:    event.Target,
+		Ip:        event.Ip,
+		UserAgent: event.UserAgent,
+		RequestId: event.RequestID,
+	}
+	if event.ActorID.Valid {
+		response.ActorId = event.ActorID.UUID.String()
+	}
+	if event.SubjectID.Valid {
+		response.SubjectId = event.SubjectID.UUID.String()
+	}
+	if json.Valid([]byte(event.Details)) && event.Details != "{}" {
+		response.Details = json.RawMessage(event.Details)
+	}
+	return response
+}
+
+// auditPage reads the limit and before query parameters shared by the audit
+// listings. Events come newest first; passing the next_before of a page as
+// before fetches the one after it.
+func auditPage(r *http.Request, params *database.ListAuditEventsParams) []FieldError {
+	query := r.URL.Query()
+	fields := []FieldError{}
+
+	params.Limit = defaultAuditPage
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAuditPage {
+			fields = append(fields, FieldError{Field: "limit", Code: "out_of_range", Message: "limit must be between 1 and 200"})
+		}
+		params.Limit = int32(limit)
+	}
+	if raw := query.Get("before"); raw != "" {
+		before, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			fields = append(fields, FieldError{Field: "before", Code: "invalid_format", Message: "before must be an event id"})
+		}
+		params.BeforeID = sql.NullInt64{Int64: before, Valid: true}
+	}
+	return fields
+}
+
+// newSecurityEventResponse is the view of an event users get about their own
+// account: what happened to it, not our internals.
+func newSecurityEventResponse(event database.AuditEvent) auditEventResponse {
+	response := newAuditEventResponse(event)
+	response.ActorId, response.RequestId, response.Details = "", "", nil
+	return response
+}
+
+// listAllSecurityEvents pages through every event about the user, newest
+// first.
+func (cfg *Config) listAllSecurityEvents(ctx context.Context, userID uuid.UUID) ([]database.AuditEvent, error) {
+	params := database.ListAuditEventsParams{
+		SubjectID: uuid.NullUUID{UUID: userID, Valid: true},
+		Limit:     maxAuditPage,
+	}
+	all := []database.AuditEvent{}
+	for {
+		events, err := cfg.DbQueries.ListAuditEvents(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, events...)
+		if len(events) < int(params.Limit) {
+			return all, nil
+		}
+		params.BeforeID = sql.NullInt64{Int64: events[len(events)-1].ID, Valid: true}
+	}
+}
+
+func respondAuditEvents(w http.ResponseWriter, events []database.AuditEvent, limit int32, public bool) {
+	response := struct {
+		Events     []auditEventResponse `json:"items"`
+		NextBefore int64                `json:"next_before,omitempty"`
+	}{
+		Events: []auditEventResponse{},
+	}
+	for _, event := range events {
+		if public {
+			response.Events = append(response.Events, newSecurityEventResponse(event))
+		} else {
+			response.Events = append(response.Events, newAuditEventResponse(event))
+		}
+	}
+	if len(events) == int(limit) {
+		response.NextBefore = events[len(events)-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListAuditEvents is the admin view of the audit trail, filterable by
+// action, outcome, actor_id, user_id (the affected account) and since.
+func (cfg *Config) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	query := r.URL.Query()
+	params := database.ListAuditEventsParams{}
+	fields := auditPage(r, &params)
+	if action := query.Get("action"); action != "" {
+		params.Action = sql.NullString{String: action, Valid: true}
+	}
+	if outcome := query.Get("outcome"); outcome != "" {
+		if outcome != OutcomeSuccess && outcome != OutcomeFailure {
+			fields = append(fields, FieldError{Field: "outcome", Code: "invalid_format", Message: "outcome must be success or failure"})
+		}
+		params.Outcome = sql.NullString{String: outcome, Valid: true}
+	}
+	for _, filter := range []struct {
+		name string
+		dst  *uuid.NullUUID
+	}{{"actor_id", &params.ActorID}, {"user_id", &params.SubjectID}} {
+		raw := query.Get(filter.name)
+		if raw == "" {
+			continue
+		}
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			fields = append(fields, FieldError{Field: filter.name, Code: "invalid_format", Message: filter.name + " must be a UUID"})
+		}
+		*filter.dst = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	if raw := query.Get("since"); raw != "" {
+		since, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			fields = append(fields, FieldError{Field: "since", Code: "invalid_format", Message: "since must be an RFC 3339 timestamp"})
+		}
+		params.Since = sql.NullTime{Time: since, Valid: true}
+	}
+	if len(fields) > 0 {
+		respondError(w, r, errValidation(fields...))
+		return
+	}
+
+	events, err := cfg.DbQueries.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		logger.Errorw("listing audit events", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	respondAuditEvents(w, events, params.Limit, false)
+}
+
+// ListSecurityEvents shows users the audit trail of their own account, so
+// they can spot sign-ins and changes they don't recognise.
+func (cfg *Config) ListSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+
+	params := database.ListAuditEventsParams{
+		SubjectID: uuid.NullUUID{UUID: principal.UserID, Valid: true},
+	}
+	if fields := auditPage(r, &params); len(fields) > 0 {
+		respondError(w, r, errValidation(fields...))
+		return
+	}
+
+	events, err := cfg.DbQueries.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		logger.Errorw("listing security events", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	respondAuditEvents(w, events, params.Limit, true)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	cfg := &Config{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxy", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"untrusted peer can't spoof", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.2:4000", nil, "10.0.0.2"},
+		{"chain of trusted proxies", "10.0.0.2:4000", []string{"198.51.100.1, 10.0.0.5", "10.0.0.3"}, "198.51.100.1"},
+		{"client spoofs the start of the chain", "10.0.0.2:4000", []string{"192.0.2.9, 198.51.100.1"}, "198.51.100.1"},
+		{"junk stops at the last proxy", "10.0.0.2:4000", []string{"198.51.100.1, junk, 10.0.0.5"}, "10.0.0.5"},
+		{"ipv6 proxy", "[fd00::1]:4000", []string{"2001:db8::7"}, "2001:db8::7"},
+		{"ipv4-mapped proxy", "[::ffff:10.0.0.2]:4000", []string{"::ffff:198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if got := cfg.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
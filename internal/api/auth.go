@@ -3,103 +3,196 @@ package api
 import (
 	"chirpy/internal/auth"
 	"chirpy/internal/database"
+	"chirpy/internal/metrics"
+	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 func (cfg *Config) Login(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password string `json:"password" validate:"required"`
+		Email    string `json:"email" validate:"required"`
+		// UseCookies asks for a cookie session instead of tokens in the
+		// response body.
+		UseCookies bool `json:"use_cookies"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Bad request"))
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
+		return
+	}
+	if params.UseCookies && !cfg.CookieSessions {
+		respondError(w, r, errBadRequest("cookie sessions are not enabled"))
 		return
 	}
 
 	user, err := cfg.DbQueries.FindUserByEmail(r.Context(), params.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Incorrect email or password"))
+			metrics.FailedLogins.Inc()
+			cfg.audit(r, auditEvent{action: AuditLogin, outcome: OutcomeFailure,
+				details: map[string]string{"reason": "unknown_email", "email": truncateRunes(params.Email, 254)}})
+			respondError(w, r, newError(http.StatusUnauthorized, CodeInvalidCredentials, "incorrect email or password"))
 			return
 		}
-		log.Printf("Error while searching user by email")
-		w.WriteHeader(http.StatusInternalServerError)
+		logger.Errorw("searching user by email", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	// users who only sign in through an identity provider have no
+	// password, and no password matches
+	rehash, err := false, auth.ErrPasswordMismatch
+	if user.HashedPassword.Valid {
+		rehash, err = cfg.Passwords.Verify(params.Password, user.HashedPassword.String)
+	}
 	if err != nil {
-		log.Printf("Error while checking password hash equivalence")
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("Incorrect email or password"))
+		if errors.Is(err, auth.ErrPasswordMismatch) {
+			logger.Infow("password does not match", "user_id", user.ID)
+		} else {
+			logger.Errorw("checking password hash", "user_id", user.ID, "error", err)
+		}
+		metrics.FailedLogins.Inc()
+		cfg.audit(r, auditEvent{action: AuditLogin, outcome: OutcomeFailure, subject: user.ID,
+			details: map[string]string{"reason": "bad_password"}})
+		respondError(w, r, newError(http.StatusUnauthorized, CodeInvalidCredentials, "incorrect email or password"))
 		return
 	}
 
-	expires := 3600 // 1hr
-	exp := time.Duration(expires) * time.Second
-	token, err := auth.MakeJWT(user.ID, os.Getenv("JWT_SIGNING_KEY"), exp)
+	// only checked after the password so the response doesn't reveal
+	// whether a disabled account exists
+	if user.DisabledAt.Valid {
+		logger.Infow("login to disabled account", "user_id", user.ID)
+		metrics.FailedLogins.Inc()
+		cfg.audit(r, auditEvent{action: AuditLogin, outcome: OutcomeFailure, subject: user.ID,
+			details: map[string]string{"reason": "account_disabled"}})
+		respondError(w, r, errAccountDisabled())
+		return
+	}
+
+	// this is the only time we see the plain password, so it's the chance
+	// to move bcrypt and outdated argon2 hashes to the current parameters
+	if rehash {
+		cfg.rehashPassword(r.Context(), user, params.Password)
+	}
+
+	session, err := cfg.startSession(r.Context(), w, user.ID, params.UseCookies)
 	if err != nil {
-		log.Printf("creating JWT for user: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("starting session", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
-	refreshToken, err := auth.MakeRefreshToken()
+	metrics.Logins.Inc()
+	cfg.audit(r, auditEvent{action: AuditLogin, outcome: OutcomeSuccess, actor: user.ID, subject: user.ID,
+		details: map[string]string{"method": "password"}})
+	respondLogin(w, user, session)
+}
+
+// rehashPassword replaces the user's stored hash with a fresh one. Failures
+// are only logged: the login itself already succeeded.
+func (cfg *Config) rehashPassword(ctx context.Context, user database.User, password string) {
+	logger := loggerFrom(ctx)
+
+	hashedPassword, err := cfg.Passwords.Hash(password)
 	if err != nil {
-		log.Printf("creating refresh token: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("rehashing password", "user_id", user.ID, "error", err)
 		return
 	}
+	// only applies while the old hash is still current, so a password
+	// change racing with this login wins
+	err = cfg.DbQueries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		ID:               user.ID,
+		HashedPassword:   sql.NullString{String: hashedPassword, Valid: true},
+		HashedPassword_2: user.HashedPassword,
+	})
+	if err != nil {
+		logger.Errorw("storing rehashed password", "user_id", user.ID, "error", err)
+		return
+	}
+	logger.Infow("upgraded password hash", "user_id", user.ID)
+}
+
+type session struct {
+	token        string
+	refreshToken string
+	csrfToken    string
+}
 
-	daysAsHours := 60 * 24
-	refreshExpires := time.Duration(daysAsHours) * time.Hour
-	err = cfg.DbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+// startSession issues an access/refresh token pair for the user. With
+// useCookies the pair goes into session cookies and only the csrf token is
+// returned for the response body.
+func (cfg *Config) startSession(ctx context.Context, w http.ResponseWriter, userID uuid.UUID, useCookies bool) (session, error) {
+	token, err := auth.MakeJWT(userID, cfg.JwtSigningSecret, cfg.AccessTokenTTL, time.Now())
+	if err != nil {
+		return session{}, fmt.Errorf("creating JWT: %w", err)
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return session{}, fmt.Errorf("creating refresh token: %w", err)
+	}
+
+	err = cfg.DbQueries.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
 		Token: refreshToken,
 		UserID: uuid.NullUUID{
-			UUID:  user.ID,
+			UUID:  userID,
 			Valid: true,
 		},
-		ExpiresAt: time.Now().Add(refreshExpires).UTC(),
+		ExpiresAt: time.Now().Add(cfg.RefreshTokenTTL).UTC(),
 	})
 	if err != nil {
-		log.Printf("storing refresh token: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
-		return
+		return session{}, fmt.Errorf("storing refresh token: %w", err)
 	}
 
+	if !useCookies {
+		return session{token: token, refreshToken: refreshToken}, nil
+	}
+	csrfToken, err := cfg.setSessionCookies(w, token, refreshToken)
+	if err != nil {
+		return session{}, fmt.Errorf("creating csrf token: %w", err)
+	}
+	return session{csrfToken: csrfToken}, nil
+}
+
+func respondLogin(w http.ResponseWriter, user database.User, s session) {
 	response := struct {
 		Id           string `json:"id"`
 		CreatedAt    string `json:"created_at"`
 		UpdatedAt    string `json:"updated_at"`
 		Email        string `json:"email"`
 		IsChirpyRed  bool   `json:"is_chirpy_red"`
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
+		Handle       string `json:"handle"`
+		DisplayName  string `json:"display_name"`
+		Bio          string `json:"bio"`
+		AvatarUrl    string `json:"avatar_url"`
+		Token        string `json:"token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		CSRFToken    string `json:"csrf_token,omitempty"`
 	}{
 		Id:           user.ID.String(),
 		CreatedAt:    user.CreatedAt.UTC().Format(time.RFC3339),
 		UpdatedAt:    user.UpdatedAt.UTC().Format(time.RFC3339),
 		Email:        user.Email,
 		IsChirpyRed:  user.IsChirpyRed,
-		Token:        token,
-		RefreshToken: refreshToken,
+		Handle:       user.Handle,
+		DisplayName:  user.DisplayName,
+		Bio:          user.Bio,
+		AvatarUrl:    user.AvatarUrl,
+		Token:        s.token,
+		RefreshToken: s.refreshToken,
+		CSRFToken:    s.csrfToken,
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -107,12 +200,13 @@ func (cfg *Config) Login(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *Config) Refresh(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
 	// get the refresh token
-	refreshToken, err := auth.GetBearerToken(r.Header)
+	refreshToken, fromCookie, err := cfg.requestToken(r, RefreshCookie)
 	if err != nil {
-		log.Printf("decoding parameters: %s", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+		logger.Infow("decoding parameters", "error", err)
+		respondError(w, r, errUnauthorized("missing or invalid refresh token"))
 		return
 	}
 
@@ -120,58 +214,72 @@ func (cfg *Config) Refresh(w http.ResponseWriter, r *http.Request) {
 	refresh, err := cfg.DbQueries.FindRefreshToken(r.Context(), refreshToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Printf("refresh token not found")
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("UNAUTHORIZED"))
+			logger.Infow("refresh token not found")
+			respondError(w, r, errUnauthorized("missing or invalid refresh token"))
 			return
 		}
-		log.Printf("finding refresh token in db: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("finding refresh token in db", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if refresh.RevokedAt.Valid {
+		logger.Infow("refresh token revoked")
+		cfg.audit(r, auditEvent{action: AuditRefresh, outcome: OutcomeFailure, subject: refresh.UserID.UUID,
+			details: map[string]string{"reason": "token_revoked"}})
+		respondError(w, r, errUnauthorized("missing or invalid refresh token"))
 		return
 	}
 	if time.Now().After(refresh.ExpiresAt) {
-		log.Printf("refresh token expired")
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("TOKEN EXPIRED"))
+		logger.Infow("refresh token expired")
+		respondError(w, r, newError(http.StatusUnauthorized, CodeTokenExpired, "refresh token has expired"))
 		return
 	}
 
 	user, err := cfg.DbQueries.FindUserById(r.Context(), refresh.UserID.UUID)
 	if err != nil {
-		log.Printf("finding user by id")
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte("USER NOT FOUND"))
+		logger.Infow("finding user by id", "error", err)
+		respondError(w, r, errNotFound("user not found"))
+		return
+	}
+	if user.DisabledAt.Valid {
+		logger.Infow("refresh for disabled account", "user_id", user.ID)
+		cfg.audit(r, auditEvent{action: AuditRefresh, outcome: OutcomeFailure, subject: user.ID,
+			details: map[string]string{"reason": "account_disabled"}})
+		respondError(w, r, errAccountDisabled())
 		return
 	}
 
-	expires := 3600 // 1hr
-	exp := time.Duration(expires) * time.Second
-	token, err := auth.MakeJWT(user.ID, os.Getenv("JWT_SIGNING_KEY"), exp)
+	// the refresh token was created when the user signed in
+	token, err := auth.MakeJWT(user.ID, cfg.JwtSigningSecret, cfg.AccessTokenTTL, refresh.CreatedAt)
 	if err != nil {
-		log.Printf("creating JWT for user: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("creating JWT for user", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
 	response := struct {
-		Token string `json:"token"`
+		Token string `json:"token,omitempty"`
 	}{
 		Token: token,
 	}
+	if fromCookie {
+		cfg.setAccessCookie(w, token)
+		response.Token = ""
+	}
+	cfg.audit(r, auditEvent{action: AuditRefresh, outcome: OutcomeSuccess, actor: user.ID, subject: user.ID})
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
 func (cfg *Config) Revoke(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
 	// get the refresh token
-	refreshToken, err := auth.GetBearerToken(r.Header)
+	refreshToken, fromCookie, err := cfg.requestToken(r, RefreshCookie)
 	if err != nil {
-		log.Printf("decoding parameters: %s", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+		logger.Infow("decoding parameters", "error", err)
+		respondError(w, r, errUnauthorized("missing or invalid refresh token"))
 		return
 	}
 
@@ -179,30 +287,31 @@ func (cfg *Config) Revoke(w http.ResponseWriter, r *http.Request) {
 	refresh, err := cfg.DbQueries.FindRefreshToken(r.Context(), refreshToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Printf("refresh token not found")
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("UNAUTHORIZED"))
+			logger.Infow("refresh token not found")
+			respondError(w, r, errUnauthorized("missing or invalid refresh token"))
 			return
 		}
-		log.Printf("finding refresh token in db: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("finding refresh token in db", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 	if time.Now().After(refresh.ExpiresAt) {
-		log.Printf("refresh token expired")
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("TOKEN EXPIRED"))
+		logger.Infow("refresh token expired")
+		respondError(w, r, newError(http.StatusUnauthorized, CodeTokenExpired, "refresh token has expired"))
 		return
 	}
 
 	err = cfg.DbQueries.UpdateRefreshToken(r.Context(), refreshToken)
 	if err != nil {
-		log.Printf("updating refresh token in db")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("updating refresh token in db")
+		respondError(w, r, errInternal())
 		return
 	}
+	if fromCookie {
+		clearSessionCookies(w)
+	}
+	cfg.audit(r, auditEvent{action: AuditRevoke, outcome: OutcomeSuccess,
+		actor: refresh.UserID.UUID, subject: refresh.UserID.UUID})
 
 	w.WriteHeader(http.StatusNoContent)
 }
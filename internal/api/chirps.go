@@ -1,148 +1,128 @@
 package api
 
 import (
-	"chirpy/internal/auth"
+	"chirpy/internal/authz"
 	"chirpy/internal/database"
+	"chirpy/internal/metrics"
+	"chirpy/internal/preview"
+	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
 
 func (cfg *Config) CreateChirp(w http.ResponseWriter, r *http.Request) {
-	// validate auth before processing any further
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("extracting bearer token from header: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
-		return
-	}
+	logger := loggerFrom(r.Context())
 
-	userId, err := auth.ValidateJWT(token, os.Getenv("JWT_SIGNING_KEY"))
-	if err != nil {
-		log.Printf("validating token: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
 		return
 	}
 
 	// process the request
 	type parameters struct {
-		Body   string `json:"body"`
-		UserId string `json:"user_id"`
-	}
-	type errorBody struct {
-		Err string `json:"error"`
+		Body      string     `json:"body" validate:"required"`
+		UserId    string     `json:"user_id" validate:"required,uuid"`
+		PublishAt *time.Time `json:"publish_at"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		w.WriteHeader(http.StatusBadRequest)
-		errBody := errorBody{
-			Err: "Something went wrong",
-		}
-		eBody, err := json.Marshal(errBody)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
-			return
-		}
-		w.Write(eBody)
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
+		return
 	}
 
-	if userId.String() != params.UserId {
-		log.Printf("WARNING: User '%s' is requesting User '%s' resources", userId, params.UserId)
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte("FORBIDDEN"))
+	authorId, _ := uuid.Parse(params.UserId)
+	if err := authz.CanCreateChirp(principal, authorId); err != nil {
+		logger.Warnw("request denied", "user_id", principal.UserID, "requested_user_id", params.UserId, "error", err)
+		respondError(w, r, errDenied(err))
 		return
 	}
+	userId := principal.UserID
 
-	if len(params.Body) > 140 {
-		w.WriteHeader(http.StatusBadRequest)
-		errBody := errorBody{
-			Err: "Chirp is too long",
-		}
-		eBody, err := json.Marshal(errBody)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
+	// a publish_at in the future stores the chirp as a draft that only the
+	// author can see until the scheduler publishes it
+	now := time.Now().UTC()
+	publishAt := sql.NullTime{}
+	publishedAt := sql.NullTime{Time: now, Valid: true}
+	if params.PublishAt != nil && params.PublishAt.After(now) {
+		if params.PublishAt.After(now.Add(cfg.MaxScheduleAhead)) {
+			respondError(w, r, errValidation(FieldError{
+				Field:   "publish_at",
+				Code:    "too_far_ahead",
+				Message: "chirps can be scheduled at most " + describeDuration(cfg.MaxScheduleAhead) + " ahead",
+			}))
 			return
 		}
-		w.Write(eBody)
-	} else if len(params.Body) == 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		errBody := errorBody{
-			Err: "Request JSON should be in shape {'body': 'chirp message...'}",
-		}
-		eBody, err := json.Marshal(errBody)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
-			return
-		}
-		w.Write(eBody)
-	} else {
-		profaneWords := []string{"kerfuffle", "sharbert", "fornax"}
-		cleanedBody := strings.ToLower(params.Body)
-
-		for _, word := range profaneWords {
-			pattern := regexp.MustCompile(`(?i)\b` + word + `\b`)
-			cleanedBody = pattern.ReplaceAllString(cleanedBody, "****")
-		}
+		publishAt = sql.NullTime{Time: params.PublishAt.UTC(), Valid: true}
+		publishedAt = sql.NullTime{}
+	}
 
-		userUUID, err := uuid.Parse(params.UserId)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	if utf8.RuneCountInString(params.Body) > cfg.MaxChirpLength {
+		respondError(w, r, errValidation(FieldError{
+			Field:   "body",
+			Code:    "too_long",
+			Message: fmt.Sprintf("body must be at most %d characters", cfg.MaxChirpLength),
+		}))
+		return
+	}
 
-		chirp, err := cfg.DbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
-			Body: cleanedBody,
-			UserID: uuid.NullUUID{
-				UUID:  userUUID,
-				Valid: true,
-			},
-		})
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	profaneWords := []string{"kerfuffle", "sharbert", "fornax"}
+	cleanedBody := strings.ToLower(params.Body)
 
-		response := struct {
-			Id        uuid.UUID `json:"id"`
-			CreatedAt string    `json:"created_at"`
-			UpdatedAt string    `json:"updated_at"`
-			Body      string    `json:"body"`
-			UserId    uuid.UUID `json:"user_id"`
-		}{
-			Id:        userUUID,
-			CreatedAt: chirp.CreatedAt.UTC().Format(time.RFC3339),
-			UpdatedAt: chirp.UpdatedAt.UTC().Format(time.RFC3339),
-			Body:      chirp.Body,
-			UserId:    chirp.UserID.UUID,
-		}
+	for _, word := range profaneWords {
+		pattern := regexp.MustCompile(`(?i)\b` + word + `\b`)
+		cleanedBody = pattern.ReplaceAllString(cleanedBody, "****")
+	}
 
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(response)
+	chirp, err := cfg.DbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body: cleanedBody,
+		UserID: uuid.NullUUID{
+			UUID:  userId,
+			Valid: true,
+		},
+		PublishAt:   publishAt,
+		PublishedAt: publishedAt,
+	})
+	if err != nil {
+		logger.Errorw("creating chirp in db", "error", err)
+		respondError(w, r, errInternal())
+		return
 	}
+
+	// unfurling happens in the background, so a preview only shows up
+	// here if the link was already cached from an earlier chirp
+	metrics.ChirpsCreated.Inc()
+	cfg.Previews.Enqueue(preview.FirstURL(chirp.Body))
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cfg.chirpResponses(r.Context(), []database.Chirp{chirp})[0])
 }
 
 func (cfg *Config) ListChirps(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
 	queryValues := r.URL.Query()
 	authorId := queryValues.Get("author_id")
-	authorUUID, err := uuid.Parse(authorId)
-	if err != nil {
-		log.Printf("invalid author id: %s", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
-		return
+	var authorUUID uuid.UUID
+	if authorId != "" {
+		parsed, err := uuid.Parse(authorId)
+		if err != nil {
+			logger.Infow("invalid author id", "error", err)
+			respondError(w, r, errBadRequest("author_id must be a UUID"))
+			return
+		}
+		authorUUID = parsed
 	}
 
 	// sort := "asc"
@@ -158,23 +138,23 @@ func (cfg *Config) ListChirps(w http.ResponseWriter, r *http.Request) {
 			Valid: true,
 		})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			respondError(w, r, errInternal())
 			return
 		}
 		chirps = chirpsList
 	} else {
 		chirpsList, err := cfg.DbQueries.ListChirps(r.Context())
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			respondError(w, r, errInternal())
 			return
 		}
 		chirps = chirpsList
 	}
 
 	response := struct {
-		Chirps []database.Chirp `json:"items"`
+		Chirps []chirpResponse `json:"items"`
 	}{
-		Chirps: chirps,
+		Chirps: cfg.chirpResponses(r.Context(), chirps),
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -185,93 +165,276 @@ func (cfg *Config) GetChirp(w http.ResponseWriter, r *http.Request) {
 	chirpID := r.PathValue("chirpID")
 	chirpUUID, err := uuid.Parse(chirpID)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		respondError(w, r, errBadRequest("chirp id must be a UUID"))
 		return
 	}
 
 	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpUUID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			w.WriteHeader(http.StatusNotFound)
+			respondError(w, r, errNotFound("chirp not found"))
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+		respondError(w, r, errInternal())
 		return
 	}
 
-	response := struct {
-		Id        string `json:"id"`
-		CreatedAt string `json:"created_at"`
-		UpdatedAt string `json:"updated_at"`
-		Body      string `json:"body"`
-		UserId    string `json:"user_id"`
-	}{
-		Id:        chirp.ID.String(),
-		CreatedAt: chirp.CreatedAt.UTC().Format(time.RFC3339),
-		UpdatedAt: chirp.UpdatedAt.UTC().Format(time.RFC3339),
-		Body:      chirp.Body,
-		UserId:    chirp.UserID.UUID.String(),
+	// scheduled chirps are only visible to their author until published;
+	// anonymous callers are simply the zero principal
+	principal := authz.Principal{}
+	if !chirp.PublishedAt.Valid {
+		principal, _ = cfg.authenticate(r)
+	}
+	if err := authz.CanViewChirp(principal, chirp); err != nil {
+		respondError(w, r, errNotFound("chirp not found"))
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(cfg.chirpResponses(r.Context(), []database.Chirp{chirp})[0])
 }
 
 func (cfg *Config) DeleteChirp(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
 	// validate auth before processing any further
-	token, err := auth.GetBearerToken(r.Header)
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, err := uuid.Parse(chirpID)
 	if err != nil {
-		log.Printf("extracting bearer token from header: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+		logger.Infow("bad chirp id")
+		respondError(w, r, errBadRequest("chirp id must be a UUID"))
 		return
 	}
 
-	userId, err := auth.ValidateJWT(token, os.Getenv("JWT_SIGNING_KEY"))
+	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpUUID)
 	if err != nil {
-		log.Printf("validating token: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+		if err == sql.ErrNoRows {
+			logger.Infow("chirp not found")
+			respondError(w, r, errNotFound("chirp not found"))
+			return
+		}
+		logger.Errorw("finding chirp", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
-	chirpID := r.PathValue("chirpID")
-	chirpUUID, err := uuid.Parse(chirpID)
+	if err := authz.CanDeleteChirp(principal, chirp); err != nil {
+		logger.Warnw("request denied", "user_id", principal.UserID, "owner_id", chirp.UserID.UUID, "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+
+	// remembered so a takedown can't be undone by the author
+	err = cfg.DbQueries.DeleteChirp(r.Context(), database.DeleteChirpParams{
+		ID:            chirpUUID,
+		DeletedBy:     uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		DeletedByRole: sql.NullString{String: principal.Role, Valid: true},
+	})
 	if err != nil {
-		log.Printf("bad chirp id")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("BAD REQUEST"))
+		logger.Errorw("deleting chirp in db", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
+	// authors deleting their own chirps is routine, admins taking them down
+	// is worth a trail
+	if chirp.UserID.UUID != principal.UserID {
+		cfg.audit(r, auditEvent{action: AuditModeratorDelete, outcome: OutcomeSuccess,
+			actor: principal.UserID, subject: chirp.UserID.UUID, target: chirp.ID.String()})
+	}
 
-	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpUUID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type linkPreview struct {
+	Url         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageUrl    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+type authorSummary struct {
+	Id          string `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	AvatarUrl   string `json:"avatar_url"`
+}
+
+type chirpResponse struct {
+	Id        string         `json:"id"`
+	CreatedAt string         `json:"created_at"`
+	UpdatedAt string         `json:"updated_at"`
+	Body      string         `json:"body"`
+	UserId    string         `json:"user_id"`
+	Author    *authorSummary `json:"author,omitempty"`
+	PublishAt string         `json:"publish_at,omitempty"`
+	Preview   *linkPreview   `json:"preview,omitempty"`
+}
+
+// chirpResponses renders chirps for the API, attaching the author summary
+// and cached link preview of each one.
+func (cfg *Config) chirpResponses(ctx context.Context, chirps []database.Chirp) []chirpResponse {
+	previews := cfg.linkPreviews(ctx, chirps)
+	authors := cfg.authorSummaries(ctx, chirps)
+
+	items := make([]chirpResponse, 0, len(chirps))
+	for _, chirp := range chirps {
+		resp := chirpResponse{
+			Id:        chirp.ID.String(),
+			CreatedAt: chirp.CreatedAt.UTC().Format(time.RFC3339),
+			UpdatedAt: chirp.UpdatedAt.UTC().Format(time.RFC3339),
+			Body:      chirp.Body,
+			UserId:    chirp.UserID.UUID.String(),
+			Author:    authors[chirp.UserID.UUID],
+			Preview:   previews[preview.FirstURL(chirp.Body)],
+		}
+		if !chirp.PublishedAt.Valid && chirp.PublishAt.Valid {
+			resp.PublishAt = chirp.PublishAt.Time.UTC().Format(time.RFC3339)
+		}
+		items = append(items, resp)
+	}
+	return items
+}
+
+// authorSummaries loads the public profile summary of every chirp author,
+// keyed by user id. Like linkPreviews, a failed lookup only drops the authors.
+func (cfg *Config) authorSummaries(ctx context.Context, chirps []database.Chirp) map[uuid.UUID]*authorSummary {
+	authors := map[uuid.UUID]*authorSummary{}
+
+	seen := map[uuid.UUID]bool{}
+	ids := []uuid.UUID{}
+	for _, chirp := range chirps {
+		if chirp.UserID.Valid && !seen[chirp.UserID.UUID] {
+			seen[chirp.UserID.UUID] = true
+			ids = append(ids, chirp.UserID.UUID)
+		}
+	}
+	if len(ids) == 0 {
+		return authors
+	}
+
+	rows, err := cfg.DbQueries.ListUserSummaries(ctx, ids)
+	if err != nil {
+		loggerFrom(ctx).Errorw("loading chirp authors", "error", err)
+		return authors
+	}
+	for _, row := range rows {
+		authors[row.ID] = &authorSummary{
+			Id:          row.ID.String(),
+			Handle:      row.Handle,
+			DisplayName: row.DisplayName,
+			AvatarUrl:   row.AvatarUrl,
+		}
+	}
+	return authors
+}
+
+// linkPreviews loads the cached previews for the first link of each chirp,
+// keyed by url. Links that haven't been unfurled yet, or failed to, are left
+// out. A lookup failure only costs the previews, never the chirps themselves.
+func (cfg *Config) linkPreviews(ctx context.Context, chirps []database.Chirp) map[string]*linkPreview {
+	previews := map[string]*linkPreview{}
+
+	urls := []string{}
+	for _, chirp := range chirps {
+		if link := preview.FirstURL(chirp.Body); link != "" {
+			urls = append(urls, link)
+		}
+	}
+	if len(urls) == 0 {
+		return previews
+	}
+
+	rows, err := cfg.DbQueries.ListLinkPreviews(ctx, urls)
+	if err != nil {
+		loggerFrom(ctx).Errorw("loading link previews", "error", err)
+		return previews
+	}
+	for _, row := range rows {
+		if row.FetchError.Valid {
+			continue
+		}
+		previews[row.Url] = &linkPreview{
+			Url:         row.Url,
+			Title:       row.Title,
+			Description: row.Description,
+			ImageUrl:    row.ImageUrl,
+			SiteName:    row.SiteName,
+		}
+	}
+	return previews
+}
+
+func (cfg *Config) RestoreChirp(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+
+	chirpUUID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		logger.Infow("bad chirp id")
+		respondError(w, r, errBadRequest("chirp id must be a UUID"))
+		return
+	}
+
+	chirp, err := cfg.DbQueries.GetDeletedChirp(r.Context(), chirpUUID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Printf("chirp not found")
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("NOT FOUND"))
+			respondError(w, r, errNotFound("chirp not found"))
 			return
 		}
-		log.Printf("finding chirp: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("finding deleted chirp", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	if err := authz.CanRestoreChirp(principal, chirp); err != nil {
+		logger.Warnw("request denied", "user_id", principal.UserID, "owner_id", chirp.UserID.UUID, "error", err)
+		respondError(w, r, errDenied(err))
 		return
 	}
 
-	if chirp.UserID.UUID != userId {
-		log.Printf("user '%s' requested data for user '%s'", userId, chirp.UserID.UUID)
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte("FORBIDDEN"))
+	if time.Since(chirp.DeletedAt.Time) > cfg.RestoreWindow {
+		respondError(w, r, newError(http.StatusGone, CodeRestoreWindowExpired, "the chirp can no longer be restored"))
 		return
 	}
 
-	err = cfg.DbQueries.DeleteChirp(r.Context(), chirpUUID)
+	restored, err := cfg.DbQueries.RestoreChirp(r.Context(), chirpUUID)
 	if err != nil {
-		log.Printf("deleting chirp in db: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("restoring chirp in db", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cfg.chirpResponses(r.Context(), []database.Chirp{restored})[0])
+}
+
+// describeDuration writes d for people: whole days or hours where it can,
+// like "365 days", and Go's notation otherwise.
+func describeDuration(d time.Duration) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return plural(int64(d/(24*time.Hour)), "day")
+	case d >= time.Hour && d%time.Hour == 0:
+		return plural(int64(d/time.Hour), "hour")
+	}
+	return d.String()
 }
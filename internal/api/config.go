@@ -1,14 +1,49 @@
 package api
 
 import (
+	"chirpy/internal/auth"
 	"chirpy/internal/database"
-	"sync/atomic"
+	"chirpy/internal/mail"
+	"chirpy/internal/oidc"
+	"chirpy/internal/preview"
+	"chirpy/internal/pwpolicy"
+	"database/sql"
+	"net/netip"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 type Config struct {
-	FileserverHits   atomic.Int32
+	DB               *sql.DB
 	DbQueries        *database.Queries
 	Platform         string
 	JwtSigningSecret string
 	PolkaKey         string
+	AdminKey         string
+	Previews         *preview.Service
+	Logger           *zap.SugaredLogger
+	// TrustedProxies may set X-Forwarded-For. See clientIP.
+	TrustedProxies []netip.Prefix
+
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+	MaxChirpLength   int
+	MaxScheduleAhead time.Duration
+	// RestoreWindow is how long after deletion an author can still restore a
+	// chirp. It must stay shorter than the purge retention period.
+	RestoreWindow time.Duration
+	// CookieSessions lets Login hand out HttpOnly session cookies instead
+	// of tokens in the body. See sessions.go.
+	CookieSessions bool
+	// OIDC are the "Sign in with..." providers, by name.
+	OIDC map[string]*oidc.Provider
+	// Passwords hashes new passwords; Login upgrades older hashes to its
+	// current parameters.
+	Passwords auth.PasswordHasher
+	// PasswordPolicy is what new passwords must meet.
+	PasswordPolicy pwpolicy.Policy
+	// Mailer sends confirmation emails, whose links start with LinkBaseURL.
+	Mailer      mail.Sender
+	LinkBaseURL string
 }
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+
+	maxBodyBytes = 1 << 20 // 1mb
+)
+
+// decodeJSON reads a single JSON object from the request body into dst and
+// runs the `validate` struct tag rules on it. Unknown fields are rejected.
+// On failure the returned error is ready to hand to respondError.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) *Error {
+	return decode(w, r, dst, true)
+}
+
+// decodeJSONLenient is decodeJSON for payloads we don't control, like
+// webhooks, where the sender is free to add fields.
+func decodeJSONLenient(w http.ResponseWriter, r *http.Request, dst any) *Error {
+	return decode(w, r, dst, false)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, dst any, strict bool) *Error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return newError(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be application/json")
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	// the body must hold exactly one value
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return decodeError(err)
+		}
+		return newError(http.StatusBadRequest, CodeInvalidJSON, "request body must contain a single JSON object")
+	}
+
+	if fields := validateStruct(dst); len(fields) > 0 {
+		return errValidation(fields...)
+	}
+	return nil
+}
+
+func decodeError(err error) *Error {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return newError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+			fmt.Sprintf("request body must be at most %d bytes", maxBytesErr.Limit))
+	case errors.Is(err, io.EOF):
+		return newError(http.StatusBadRequest, CodeInvalidJSON, "request body is empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return errInvalidJSON()
+	case errors.As(err, &typeErr):
+		return errValidation(FieldError{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonKind(typeErr.Type)),
+		})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for this one
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return errValidation(FieldError{
+			Field:   field,
+			Code:    "unknown_field",
+			Message: fmt.Sprintf("%s is not a known field", field),
+		})
+	}
+	return errInvalidJSON()
+}
+
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+// validateStruct checks the `validate` tag of every string field in v,
+// descending into nested structs. Rules are comma separated:
+//
+//	required   the value must not be empty
+//	email      a bare email address
+//	uuid       a UUID
+//	min=N      at least N characters
+//	max=N      at most N characters
+//
+// Every rule but required passes on an empty value, so optional fields only
+// get checked when they are set.
+func validateStruct(v any) []FieldError {
+	val := reflect.Indirect(reflect.ValueOf(v))
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+	return validateFields(val, "")
+}
+
+func validateFields(val reflect.Value, prefix string) []FieldError {
+	fields := []FieldError{}
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := prefix + jsonName(sf)
+		fv := val.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			fields = append(fields, validateFields(fv, name+".")...)
+			continue
+		}
+		rules := sf.Tag.Get("validate")
+		if rules == "" || fv.Kind() != reflect.String {
+			continue
+		}
+		if fe, ok := checkRules(name, fv.String(), rules); !ok {
+			fields = append(fields, fe)
+		}
+	}
+	return fields
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+// checkRules returns the first rule value breaks.
+func checkRules(field, value, rules string) (FieldError, bool) {
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg, _ := strings.Cut(rule, "=")
+		if value == "" {
+			if rule == "required" {
+				return FieldError{Field: field, Code: "required", Message: field + " is required"}, false
+			}
+			continue
+		}
+
+		switch rule {
+		case "email":
+			addr, err := mail.ParseAddress(value)
+			if err != nil || addr.Address != value {
+				return FieldError{Field: field, Code: "invalid_format", Message: field + " must be an email address"}, false
+			}
+		case "uuid":
+			if _, err := uuid.Parse(value); err != nil {
+				return FieldError{Field: field, Code: "invalid_format", Message: field + " must be a UUID"}, false
+			}
+		case "min":
+			n, _ := strconv.Atoi(arg)
+			if utf8.RuneCountInString(value) < n {
+				return FieldError{Field: field, Code: "too_short", Message: fmt.Sprintf("%s must be at least %d characters", field, n)}, false
+			}
+		case "max":
+			n, _ := strconv.Atoi(arg)
+			if utf8.RuneCountInString(value) > n {
+				return FieldError{Field: field, Code: "too_long", Message: fmt.Sprintf("%s must be at most %d characters", field, n)}, false
+			}
+		}
+	}
+	return FieldError{}, true
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type decodeTarget struct {
+	Email string `json:"email" validate:"required,email"`
+	Name  string `json:"name" validate:"min=3,max=5"`
+	Ref   struct {
+		ID string `json:"id" validate:"uuid"`
+	} `json:"ref"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		lenient     bool
+		wantStatus  int
+		wantCode    string
+		// wantField is the field the validation error points at
+		wantField string
+	}{
+		{name: "valid", body: `{"email":"a@example.com","name":"abc","ref":{"id":"0d6c5b8e-7f8a-4c1e-9a43-6a6a3c0c2c1d"}}`},
+		{name: "optional fields unset", body: `{"email":"a@example.com"}`},
+		{name: "content type with charset", contentType: "application/json; charset=utf-8", body: `{"email":"a@example.com"}`},
+
+		{name: "missing content type", contentType: "-", body: `{"email":"a@example.com"}`,
+			wantStatus: http.StatusUnsupportedMediaType, wantCode: CodeUnsupportedMediaType},
+		{name: "wrong content type", contentType: "text/plain", body: `{"email":"a@example.com"}`,
+			wantStatus: http.StatusUnsupportedMediaType, wantCode: CodeUnsupportedMediaType},
+		{name: "too large", body: `{"email":"a@example.com","name":"` + strings.Repeat("a", maxBodyBytes) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge, wantCode: CodePayloadTooLarge},
+		{name: "empty body", body: ``,
+			wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "syntax error", body: `{"email":`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "trailing object", body: `{"email":"a@example.com"}{"email":"b@example.com"}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "trailing garbage", body: `{"email":"a@example.com"} junk`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "unknown field", body: `{"email":"a@example.com","admin":true}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantField: "admin"},
+		{name: "unknown field when lenient", body: `{"email":"a@example.com","admin":true}`, lenient: true},
+		{name: "wrong type", body: `{"email":42}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantField: "email"},
+
+		{name: "required", body: `{"name":"abc"}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantField: "email"},
+		{name: "email", body: `{"email":"not an email"}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantField: "email"},
+		{name: "email with display name", body: `{"email":"A <a@example.com>"}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantField: "email"},
+		{name: "uuid", body: `{"email":"a@example.com","ref":{"id":"nope"}}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantField: "ref.id"},
+		{name: "min", body: `{"email":"a@example.com","name":"ab"}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantField: "name"},
+		{name: "min counts characters", body: `{"email":"a@example.com","name":"日本語"}`},
+		{name: "max", body: `{"email":"a@example.com","name":"abcdef"}`,
+			wantStatus: http.StatusBadRequest, wantCode: CodeValidationFailed, wantField: "name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			switch tt.contentType {
+			case "":
+				r.Header.Set("Content-Type", "application/json")
+			case "-":
+			default:
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			dst := decodeTarget{}
+			var apiErr *Error
+			if tt.lenient {
+				apiErr = decodeJSONLenient(w, r, &dst)
+			} else {
+				apiErr = decodeJSON(w, r, &dst)
+			}
+
+			if tt.wantStatus == 0 {
+				if apiErr != nil {
+					t.Fatalf("rejected: %d %s %s %v", apiErr.Status, apiErr.Code, apiErr.Detail, apiErr.Fields)
+				}
+				return
+			}
+			if apiErr == nil {
+				t.Fatal("accepted")
+			}
+			if apiErr.Status != tt.wantStatus || apiErr.Code != tt.wantCode {
+				t.Errorf("got %d %s, want %d %s", apiErr.Status, apiErr.Code, tt.wantStatus, tt.wantCode)
+			}
+			if tt.wantField != "" && (len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != tt.wantField) {
+				t.Errorf("fields = %v, want one for %s", apiErr.Fields, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes are part of the API contract: clients branch on them, so an
+// existing code must never be renamed or reused for something else.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidJSON          = "invalid_json"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeTokenExpired         = "token_expired"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeRestoreWindowExpired = "restore_window_expired"
+	CodeAccountDisabled      = "account_disabled"
+	CodeInternal             = "internal_error"
+)
+
+// Error is the single error type returned by every handler. It is rendered
+// as an RFC 9457 problem document.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Fields []FieldError
+}
+
+// FieldError points at the request field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Detail
+}
+
+func newError(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func errBadRequest(detail string) *Error {
+	return newError(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+func errInvalidJSON() *Error {
+	return newError(http.StatusBadRequest, CodeInvalidJSON, "request body is not valid JSON")
+}
+
+func errValidation(fields ...FieldError) *Error {
+	e := newError(http.StatusBadRequest, CodeValidationFailed, "request failed validation")
+	e.Fields = fields
+	return e
+}
+
+func errUnauthorized(detail string) *Error {
+	return newError(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+func errForbidden(detail string) *Error {
+	return newError(http.StatusForbidden, CodeForbidden, detail)
+}
+
+func errNotFound(detail string) *Error {
+	return newError(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func errAccountDisabled() *Error {
+	return newError(http.StatusForbidden, CodeAccountDisabled, "this account has been disabled")
+}
+
+func errInternal() *Error {
+	return newError(http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// respondError writes err as application/problem+json. Internal details never
+// end up in the body; handlers log them before responding.
+func respondError(w http.ResponseWriter, r *http.Request, err *Error) {
+	body := problem{
+		Type:      "urn:chirpy:problem:" + err.Code,
+		Title:     http.StatusText(err.Status),
+		Status:    err.Status,
+		Detail:    err.Detail,
+		Instance:  r.URL.Path,
+		Code:      err.Code,
+		RequestID: requestIDFrom(r.Context()),
+		Errors:    err.Fields,
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/authz"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type contextKey int
+
+const requestInfoKey contextKey = iota
+
+// requestInfo is the per-request state shared between the logging middleware
+// and the handlers. Handlers fill in the user once they have authenticated
+// the caller so the access log line can include it.
+type requestInfo struct {
+	id     string
+	logger *zap.SugaredLogger
+	userID uuid.UUID
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// MiddlewareLogging assigns every request an id, taken from an incoming
+// X-Request-ID header when it looks sane so ids propagate across services,
+// and writes one structured access log line once the request has been served.
+func (cfg *Config) MiddlewareLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		logger := cfg.Logger.With("request_id", requestID)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		info := &requestInfo{
+			id:     requestID,
+			logger: logger,
+		}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey, info))
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		fields := []any{
+			"method", r.Method,
+			"route", r.Pattern,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"latency", time.Since(start),
+		}
+		if info.userID != uuid.Nil {
+			fields = append(fields, "user_id", info.userID)
+		}
+		switch {
+		case rec.status >= 500:
+			info.logger.Errorw("request served", fields...)
+		case rec.status >= 400:
+			info.logger.Warnw("request served", fields...)
+		default:
+			info.logger.Infow("request served", fields...)
+		}
+	})
+}
+
+// loggerFrom returns the request scoped logger, falling back to a no-op
+// logger for contexts that didn't pass through MiddlewareLogging.
+func loggerFrom(ctx context.Context) *zap.SugaredLogger {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		return info.logger
+	}
+	return zap.NewNop().Sugar()
+}
+
+func requestIDFrom(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// authenticate identifies the caller from a JWT access token, sent as a
+// bearer token or session cookie, or from a personal access token, and
+// records the user on the request so it shows up in the access log. What
+// the caller may then do is up to the authz policies.
+func (cfg *Config) authenticate(r *http.Request) (authz.Principal, *Error) {
+	logger := loggerFrom(r.Context())
+
+	token, _, err := cfg.requestToken(r, AccessCookie)
+	if err != nil {
+		logger.Infow("authenticating request", "error", err)
+		return authz.Principal{}, errUnauthorized("missing or invalid access token")
+	}
+
+	principal := authz.Principal{}
+	if strings.HasPrefix(token, auth.PersonalAccessTokenPrefix) {
+		pat, apiErr := cfg.authenticatePersonalAccessToken(r, token)
+		if apiErr != nil {
+			return authz.Principal{}, apiErr
+		}
+		principal.UserID = pat.UserID
+		principal.Token = true
+		principal.Scopes = strings.Fields(pat.Scopes)
+	} else {
+		principal.UserID, principal.AuthTime, err = auth.ValidateJWT(token, cfg.JwtSigningSecret)
+		if err != nil {
+			logger.Infow("authenticating request", "error", err)
+			return authz.Principal{}, errUnauthorized("missing or invalid access token")
+		}
+	}
+
+	user, err := cfg.DbQueries.FindUserById(r.Context(), principal.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Infow("access token for unknown user", "user_id", principal.UserID)
+			return authz.Principal{}, errUnauthorized("missing or invalid access token")
+		}
+		logger.Errorw("finding user by id", "error", err)
+		return authz.Principal{}, errInternal()
+	}
+	principal.Role = user.Role
+	principal.Suspended = user.DisabledAt.Valid
+
+	if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+		info.userID = principal.UserID
+	}
+	trace.SpanFromContext(r.Context()).SetAttributes(semconv.EnduserID(principal.UserID.String()))
+	return principal, nil
+}
+
+// errDenied turns an authz policy's refusal into the response for it.
+func errDenied(err error) *Error {
+	switch {
+	case errors.Is(err, authz.ErrUnauthenticated):
+		return errUnauthorized(err.Error())
+	case errors.Is(err, authz.ErrSuspended):
+		return errAccountDisabled()
+	case errors.Is(err, authz.ErrScope):
+		return newError(http.StatusForbidden, CodeInsufficientScope, err.Error())
+	default:
+		return errForbidden(err.Error())
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
@@ -1,10 +1,13 @@
 package api
 
-import "net/http"
+import (
+	"chirpy/internal/metrics"
+	"net/http"
+)
 
 func (cfg *Config) MiddlewareMetrics(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.FileserverHits.Add(1)
+		metrics.FileserverHits.Inc()
 		next.ServeHTTP(w, r)
 	})
 }
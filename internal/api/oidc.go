@@ -0,0 +1,249 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/metrics"
+	"chirpy/internal/oidc"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const CodeIdentityProvider = "identity_provider_error"
+
+const (
+	oidcFlowCookie = "chirpy_oidc"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+// errEmailTaken is returned when a first-time social login brings an email
+// address that already has a password account, and the provider doesn't
+// vouch for the address.
+var errEmailTaken = errors.New("email belongs to another account")
+
+var errNoEmail = errors.New("id token has no email")
+
+// OIDCLogin starts "Sign in with <provider>" by sending the browser to the
+// provider with a fresh state, nonce and PKCE verifier.
+func (cfg *Config) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	provider, ok := cfg.OIDC[r.PathValue("provider")]
+	if !ok {
+		respondError(w, r, errNotFound("unknown identity provider"))
+		return
+	}
+
+	flow, err := oidc.NewFlow(provider.Name())
+	if err != nil {
+		logger.Errorw("starting sign-in flow", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	sealed, err := flow.Seal(cfg.JwtSigningSecret, oidcFlowTTL)
+	if err != nil {
+		logger.Errorw("sealing sign-in flow", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	target, err := provider.AuthCodeURL(r.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		logger.Errorw("building authorization url", "provider", provider.Name(), "error", err)
+		respondError(w, r, newError(http.StatusBadGateway, CodeIdentityProvider, "identity provider is unavailable"))
+		return
+	}
+
+	// Lax rather than Strict: the callback is a cross-site redirect from the
+	// provider and must still carry the cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    sealed,
+		Path:     "/api/auth/" + provider.Name(),
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback finishes the sign-in: it checks the state, redeems the code,
+// verifies the ID token and issues the usual access/refresh pair for the
+// linked user, creating one on first sign-in.
+func (cfg *Config) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	provider, ok := cfg.OIDC[r.PathValue("provider")]
+	if !ok {
+		respondError(w, r, errNotFound("unknown identity provider"))
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		logger.Infow("identity provider refused sign-in", "provider", provider.Name(), "error", providerErr)
+		respondError(w, r, errUnauthorized("sign-in was cancelled or refused by the identity provider"))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		respondError(w, r, errBadRequest("sign-in attempt expired, please start again"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Path:     "/api/auth/" + provider.Name(),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	flow, err := oidc.OpenFlow(cookie.Value, cfg.JwtSigningSecret)
+	if err != nil || flow.Provider != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(query.Get("state"))) != 1 {
+		logger.Infow("sign-in state mismatch", "provider", provider.Name(), "error", err)
+		respondError(w, r, errBadRequest("sign-in attempt expired, please start again"))
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), flow.Verifier)
+	if err != nil {
+		logger.Warnw("exchanging authorization code", "provider", provider.Name(), "error", err)
+		respondError(w, r, newError(http.StatusBadGateway, CodeIdentityProvider, "could not complete sign-in with the identity provider"))
+		return
+	}
+	claims, err := provider.Verify(r.Context(), rawIDToken, flow.Nonce)
+	if err != nil {
+		logger.Warnw("verifying id token", "provider", provider.Name(), "error", err)
+		respondError(w, r, errUnauthorized("invalid id token"))
+		return
+	}
+
+	user, err := cfg.userForIdentity(r.Context(), provider.Name(), claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailTaken):
+			respondError(w, r, newError(http.StatusConflict, CodeConflict,
+				"an account with this email already exists, sign in with your password"))
+		case errors.Is(err, errNoEmail):
+			respondError(w, r, errBadRequest("the identity provider did not share an email address"))
+		default:
+			logger.Errorw("finding user for identity", "provider", provider.Name(), "error", err)
+			respondError(w, r, errInternal())
+		}
+		return
+	}
+	if user.DisabledAt.Valid {
+		logger.Infow("social login to disabled account", "user_id", user.ID)
+		metrics.FailedLogins.Inc()
+		cfg.audit(r, auditEvent{action: AuditLogin, outcome: OutcomeFailure, subject: user.ID,
+			details: map[string]string{"reason": "account_disabled", "method": provider.Name()}})
+		respondError(w, r, errAccountDisabled())
+		return
+	}
+
+	session, err := cfg.startSession(r.Context(), w, user.ID, cfg.CookieSessions)
+	if err != nil {
+		logger.Errorw("starting session", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	metrics.Logins.Inc()
+	cfg.audit(r, auditEvent{action: AuditLogin, outcome: OutcomeSuccess, actor: user.ID, subject: user.ID,
+		details: map[string]string{"method": provider.Name()}})
+
+	// browsers land here from the provider; with cookie sessions they can
+	// go straight back to the app
+	if cfg.CookieSessions {
+		http.Redirect(w, r, "/app/", http.StatusSeeOther)
+		return
+	}
+	respondLogin(w, user, session)
+}
+
+// userForIdentity returns the user linked to the provider's subject. On a
+// first sign-in it links the user with the same verified email, or creates
+// a new user.
+func (cfg *Config) userForIdentity(ctx context.Context, provider string, claims *oidc.Claims) (database.User, error) {
+	identity, err := cfg.DbQueries.FindUserIdentity(ctx, database.FindUserIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		err = cfg.DbQueries.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		return cfg.DbQueries.FindUserById(ctx, identity.UserID)
+	}
+	if err != sql.ErrNoRows {
+		return database.User{}, err
+	}
+	if claims.Email == "" {
+		return database.User{}, errNoEmail
+	}
+
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	q := cfg.DbQueries.InTx(tx)
+
+	var userID uuid.UUID
+	existing, err := q.FindUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil && claims.EmailVerified:
+		userID = existing.ID
+	case err == nil:
+		return database.User{}, errEmailTaken
+	case err == sql.ErrNoRows:
+		// social-only users have no password until they set one
+		created, err := q.CreateUser(ctx, database.CreateUserParams{
+			Email:       claims.Email,
+			Handle:      DefaultHandle(),
+			DisplayName: truncateRunes(strings.TrimSpace(claims.Name), 50),
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		userID = created.ID
+	default:
+		return database.User{}, err
+	}
+
+	err = q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+		UserID:   userID,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := q.FindUserById(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
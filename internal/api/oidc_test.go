@@ -0,0 +1,316 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/dbtest"
+	"chirpy/internal/migrate"
+	"chirpy/internal/oidc"
+	"chirpy/sql/schema"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const testClientID = "chirpy-test"
+
+// mockIssuer is an OpenID provider serving discovery, its JWKS and a token
+// endpoint that hands out an ID token with whatever claims the test set.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Errorf("signing id token: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// authorize plays the provider's sign-in page: it remembers the PKCE
+// challenge and sets the claims of the ID token the code will redeem for.
+func (m *mockIssuer) authorize(authURL *url.URL, claims jwt.MapClaims) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.challenge = authURL.Query().Get("code_challenge")
+	m.claims = jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          authURL.Query().Get("nonce"),
+		"email":          "social@example.com",
+		"email_verified": true,
+		"name":           "Social User",
+	}
+	for k, v := range claims {
+		m.claims[k] = v
+	}
+}
+
+func newOIDCConfig(issuer *mockIssuer) *Config {
+	return &Config{
+		JwtSigningSecret: "secret",
+		AccessTokenTTL:   time.Hour,
+		RefreshTokenTTL:  24 * time.Hour,
+		OIDC: map[string]*oidc.Provider{"mock": oidc.NewProvider(oidc.Config{
+			Name:        "mock",
+			Issuer:      issuer.URL,
+			ClientID:    testClientID,
+			RedirectURL: "https://chirpy.test/api/auth/mock/callback",
+		})},
+	}
+}
+
+// startLogin runs OIDCLogin and returns where it sent the browser and the
+// flow cookie it set.
+func startLogin(t *testing.T, cfg *Config) (*url.URL, *http.Cookie) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/api/auth/mock/login", nil)
+	r.SetPathValue("provider", "mock")
+	w := httptest.NewRecorder()
+	cfg.OIDCLogin(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, body %s", w.Code, w.Body)
+	}
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcFlowCookie {
+			return authURL, c
+		}
+	}
+	t.Fatal("login set no flow cookie")
+	return nil, nil
+}
+
+func callback(cfg *Config, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/auth/mock/callback?"+url.Values{
+		"code":  {"code"},
+		"state": {state},
+	}.Encode(), nil)
+	r.SetPathValue("provider", "mock")
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	cfg.OIDCCallback(w, r)
+	return w
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	issuer := newMockIssuer(t)
+	cfg := newOIDCConfig(issuer)
+
+	expired, err := oidc.Flow{Provider: "mock", State: "state", Nonce: "nonce", Verifier: "verifier"}.
+		Seal(cfg.JwtSigningSecret, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// run signs in against the mock issuer and returns the callback's
+		// response
+		run  func(t *testing.T) *httptest.ResponseRecorder
+		want int
+	}{
+		{
+			name: "state mismatch",
+			run: func(t *testing.T) *httptest.ResponseRecorder {
+				authURL, cookie := startLogin(t, cfg)
+				issuer.authorize(authURL, nil)
+				return callback(cfg, "forged", cookie)
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "nonce mismatch",
+			run: func(t *testing.T) *httptest.ResponseRecorder {
+				authURL, cookie := startLogin(t, cfg)
+				issuer.authorize(authURL, jwt.MapClaims{"nonce": "replayed"})
+				return callback(cfg, authURL.Query().Get("state"), cookie)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "expired flow cookie",
+			run: func(t *testing.T) *httptest.ResponseRecorder {
+				return callback(cfg, "state", &http.Cookie{Name: oidcFlowCookie, Value: expired})
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "missing flow cookie",
+			run: func(t *testing.T) *httptest.ResponseRecorder {
+				authURL, _ := startLogin(t, cfg)
+				issuer.authorize(authURL, nil)
+				return callback(cfg, authURL.Query().Get("state"), nil)
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "token for another client",
+			run: func(t *testing.T) *httptest.ResponseRecorder {
+				authURL, cookie := startLogin(t, cfg)
+				issuer.authorize(authURL, jwt.MapClaims{"aud": "someone-else"})
+				return callback(cfg, authURL.Query().Get("state"), cookie)
+			},
+			want: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := tt.run(t); w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackUsers(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	migrator, err := migrate.New(db, schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := newMockIssuer(t)
+	cfg := newOIDCConfig(issuer)
+	cfg.DB = db
+	cfg.DbQueries = database.New(db)
+
+	existing, err := cfg.DbQueries.CreateUser(ctx, database.CreateUserParams{
+		Email:  "taken@example.com",
+		Handle: "taken",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func(t *testing.T, claims jwt.MapClaims) *httptest.ResponseRecorder {
+		t.Helper()
+		authURL, cookie := startLogin(t, cfg)
+		issuer.authorize(authURL, claims)
+		return callback(cfg, authURL.Query().Get("state"), cookie)
+	}
+
+	t.Run("first login creates a passwordless user", func(t *testing.T) {
+		w := signIn(t, jwt.MapClaims{"sub": "new-user", "email": "new@example.com"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		user, err := cfg.DbQueries.FindUserByEmail(ctx, "new@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.HashedPassword.Valid {
+			t.Error("social-only user has a password")
+		}
+		if user.DisplayName != "Social User" {
+			t.Errorf("display name = %q, want the name claim", user.DisplayName)
+		}
+
+		// and signing in again finds the same user
+		w = signIn(t, jwt.MapClaims{"sub": "new-user", "email": "new@example.com"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("second sign-in: status = %d, body %s", w.Code, w.Body)
+		}
+		var response struct {
+			Id string `json:"id"`
+		}
+		json.NewDecoder(w.Body).Decode(&response)
+		if response.Id != user.ID.String() {
+			t.Errorf("signed in as %s, want %s", response.Id, user.ID)
+		}
+	})
+
+	t.Run("unverified email of an existing user conflicts", func(t *testing.T) {
+		w := signIn(t, jwt.MapClaims{"sub": "squatter", "email": "taken@example.com", "email_verified": false})
+		if w.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want %d, body %s", w.Code, http.StatusConflict, w.Body)
+		}
+		_, err := cfg.DbQueries.FindUserIdentity(ctx, database.FindUserIdentityParams{Provider: "mock", Subject: "squatter"})
+		if err == nil {
+			t.Error("identity was linked despite the conflict")
+		}
+	})
+
+	t.Run("verified email links the existing user", func(t *testing.T) {
+		w := signIn(t, jwt.MapClaims{"sub": "owner", "email": "taken@example.com"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		identity, err := cfg.DbQueries.FindUserIdentity(ctx, database.FindUserIdentityParams{Provider: "mock", Subject: "owner"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.UserID != existing.ID {
+			t.Errorf("linked to %s, want %s", identity.UserID, existing.ID)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"chirpy/internal/authz"
+	"chirpy/internal/database"
+	"context"
+	"net/http"
+	"time"
+)
+
+const CodeReauthenticationRequired = "reauthentication_required"
+
+// reauthWindow is how recently a user without a password must have signed
+// in to make the changes that otherwise take their password.
+const reauthWindow = 10 * time.Minute
+
+// checkPassword applies the password policy to a new password. It returns
+// a field error per broken rule; personal are the user's own details, which
+// the password must not contain.
+func (cfg *Config) checkPassword(ctx context.Context, password string, personal ...string) ([]FieldError, *Error) {
+	violations, err := cfg.PasswordPolicy.Check(ctx, password, personal...)
+	if err != nil {
+		loggerFrom(ctx).Errorw("checking password policy", "error", err)
+		return nil, errInternal()
+	}
+
+	fields := []FieldError{}
+	for _, v := range violations {
+		fields = append(fields, FieldError{Field: "password", Code: v.Code, Message: v.Message})
+	}
+	return fields, nil
+}
+
+// confirmIdentity makes sure a stolen access token alone isn't enough to
+// take the account over. Users with a password must send it in field.
+// Users who only sign in through an identity provider have none, so their
+// session must be recent instead; if it isn't, they sign in with the
+// provider again. The returned reason is for the audit log.
+func (cfg *Config) confirmIdentity(r *http.Request, principal authz.Principal, user database.User, field, password string) (string, *Error) {
+	logger := loggerFrom(r.Context())
+
+	if !user.HashedPassword.Valid {
+		if time.Since(principal.AuthTime) > reauthWindow {
+			logger.Infow("sign-in too old to confirm identity", "user_id", user.ID)
+			return "stale_login", newError(http.StatusUnauthorized, CodeReauthenticationRequired,
+				"sign in again to confirm it's you")
+		}
+		return "", nil
+	}
+	if password == "" {
+		return "missing_password", errValidation(FieldError{Field: field, Code: "required", Message: field + " is required"})
+	}
+	if _, err := cfg.Passwords.Verify(password, user.HashedPassword.String); err != nil {
+		logger.Warnw("password re-confirmation failed", "user_id", user.ID)
+		return "bad_password", newError(http.StatusUnauthorized, CodeInvalidCredentials, "incorrect password")
+	}
+	return "", nil
+}
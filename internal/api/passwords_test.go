@@ -0,0 +1,50 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/authz"
+	"chirpy/internal/database"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConfirmIdentity(t *testing.T) {
+	cfg := &Config{Passwords: auth.PasswordHasher{Params: auth.PasswordParams{Memory: 64, Iterations: 1, Parallelism: 1}}}
+	hash, err := cfg.Passwords.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPassword := database.User{HashedPassword: sql.NullString{String: hash, Valid: true}}
+	passwordless := database.User{}
+
+	tests := []struct {
+		name     string
+		user     database.User
+		authTime time.Time
+		password string
+		// wantCode is the error code, empty when the identity is confirmed
+		wantCode string
+	}{
+		{name: "right password", user: withPassword, password: "correct horse"},
+		{name: "wrong password", user: withPassword, password: "battery staple", wantCode: CodeInvalidCredentials},
+		{name: "missing password", user: withPassword, authTime: time.Now(), wantCode: CodeValidationFailed},
+		{name: "passwordless, fresh sign-in", user: passwordless, authTime: time.Now().Add(-time.Minute)},
+		{name: "passwordless, old sign-in", user: passwordless, authTime: time.Now().Add(-time.Hour), wantCode: CodeReauthenticationRequired},
+		{name: "passwordless, no sign-in time", user: passwordless, password: "anything", wantCode: CodeReauthenticationRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/api/users/me", nil)
+			_, apiErr := cfg.confirmIdentity(r, authz.Principal{AuthTime: tt.authTime}, tt.user, "password", tt.password)
+			switch {
+			case tt.wantCode == "" && apiErr != nil:
+				t.Errorf("got %s, want the identity confirmed", apiErr.Code)
+			case tt.wantCode != "" && (apiErr == nil || apiErr.Code != tt.wantCode):
+				t.Errorf("got %v, want %s", apiErr, tt.wantCode)
+			}
+		})
+	}
+}
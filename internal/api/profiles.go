@@ -0,0 +1,106 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// reservedHandles can't be claimed because they collide with routes or could
+// be used to impersonate staff.
+var reservedHandles = map[string]bool{
+	"me":      true,
+	"admin":   true,
+	"api":     true,
+	"chirpy":  true,
+	"support": true,
+}
+
+// GetUserProfile is the public view of a user. There is no follow model yet,
+// so the response carries no follower_count rather than a made-up zero; it
+// gets one alongside following.
+func (cfg *Config) GetUserProfile(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	handle := strings.ToLower(r.PathValue("handle"))
+
+	profile, err := cfg.DbQueries.GetUserProfile(r.Context(), handle)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, r, errNotFound("user not found"))
+			return
+		}
+		logger.Errorw("finding user profile", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	response := struct {
+		Id          string `json:"id"`
+		CreatedAt   string `json:"created_at"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarUrl   string `json:"avatar_url"`
+		ChirpCount  int64  `json:"chirp_count"`
+	}{
+		Id:          profile.ID.String(),
+		CreatedAt:   profile.CreatedAt.UTC().Format(time.RFC3339),
+		Handle:      profile.Handle,
+		DisplayName: profile.DisplayName,
+		Bio:         profile.Bio,
+		AvatarUrl:   profile.AvatarUrl,
+		ChirpCount:  profile.ChirpCount,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ValidateProfile reports every profile field that is out of bounds, so a
+// client can flag all of them at once. The CLI uses it too, so it can't
+// create users the API would refuse.
+func ValidateProfile(handle, displayName, bio, avatarUrl string) []FieldError {
+	fields := []FieldError{}
+	if !handlePattern.MatchString(handle) {
+		fields = append(fields, FieldError{Field: "handle", Code: "invalid_format", Message: "handle must be 3-30 characters of a-z, 0-9 or _"})
+	} else if reservedHandles[handle] {
+		fields = append(fields, FieldError{Field: "handle", Code: "reserved", Message: fmt.Sprintf("handle %q is reserved", handle)})
+	}
+	if utf8.RuneCountInString(displayName) > 50 {
+		fields = append(fields, FieldError{Field: "display_name", Code: "too_long", Message: "display name must be at most 50 characters"})
+	}
+	if utf8.RuneCountInString(bio) > 160 {
+		fields = append(fields, FieldError{Field: "bio", Code: "too_long", Message: "bio must be at most 160 characters"})
+	}
+	if avatarUrl != "" {
+		u, err := url.Parse(avatarUrl)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			fields = append(fields, FieldError{Field: "avatar_url", Code: "invalid_format", Message: "avatar url must be an https url"})
+		}
+	}
+	return fields
+}
+
+// DefaultHandle matches the placeholder handles given to accounts that
+// existed before handles were introduced.
+func DefaultHandle() string {
+	return "user_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
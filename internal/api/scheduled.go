@@ -0,0 +1,105 @@
+package api
+
+import (
+	"chirpy/internal/authz"
+	"chirpy/internal/database"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func (cfg *Config) ListScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanListScheduledChirps(principal); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+	userId := principal.UserID
+
+	chirps, err := cfg.DbQueries.ListScheduledChirps(r.Context(), uuid.NullUUID{
+		UUID:  userId,
+		Valid: true,
+	})
+	if err != nil {
+		logger.Errorw("listing scheduled chirps", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	response := struct {
+		Chirps []chirpResponse `json:"items"`
+	}{
+		Chirps: cfg.chirpResponses(r.Context(), chirps),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (cfg *Config) CancelScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+
+	chirpUUID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		logger.Infow("bad chirp id")
+		respondError(w, r, errBadRequest("chirp id must be a UUID"))
+		return
+	}
+
+	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpUUID)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Errorw("finding chirp", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	// already published chirps and other people's drafts both come back as
+	// not found, so drafts don't leak
+	if err := authz.CanCancelScheduledChirp(principal, chirp); err != nil {
+		if errors.Is(err, authz.ErrForbidden) {
+			respondError(w, r, errNotFound("scheduled chirp not found"))
+			return
+		}
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+
+	// the query still only matches the caller's drafts, in case the chirp
+	// was published in the meantime
+	deleted, err := cfg.DbQueries.CancelScheduledChirp(r.Context(), database.CancelScheduledChirpParams{
+		ID: chirpUUID,
+		UserID: uuid.NullUUID{
+			UUID:  principal.UserID,
+			Valid: true,
+		},
+	})
+	if err != nil {
+		logger.Errorw("cancelling scheduled chirp", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if deleted == 0 {
+		respondError(w, r, errNotFound("scheduled chirp not found"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
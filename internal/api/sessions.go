@@ -0,0 +1,135 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+// Cookie sessions let the web app log in without its tokens ever being
+// readable from JavaScript. The access and refresh tokens travel in HttpOnly
+// cookies, and since browsers attach those to cross-site requests too, every
+// state-changing request authenticated by cookie must echo the csrf cookie
+// in the X-CSRF-Token header (the double-submit pattern).
+const (
+	AccessCookie  = "chirpy_access"
+	RefreshCookie = "chirpy_refresh"
+	CSRFCookie    = "chirpy_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+const CodeCSRFFailed = "csrf_failed"
+
+// requestToken returns the bearer token of the request or, with cookie
+// sessions on, the named cookie. A bearer token always wins.
+func (cfg *Config) requestToken(r *http.Request, cookie string) (token string, fromCookie bool, err error) {
+	token, err = bearerToken(r)
+	if err == nil || !cfg.CookieSessions {
+		return token, false, err
+	}
+	if c, cookieErr := r.Cookie(cookie); cookieErr == nil && c.Value != "" {
+		return c.Value, true, nil
+	}
+	return "", false, err
+}
+
+// bearerToken is the token of a well-formed, non-empty bearer Authorization
+// header. Anything else makes requestToken fall back to cookies, so
+// MiddlewareCSRF uses it too to tell the two apart.
+func bearerToken(r *http.Request) (string, error) {
+	return auth.GetBearerToken(r.Header)
+}
+
+// setSessionCookies starts a cookie session and returns its csrf token.
+func (cfg *Config) setSessionCookies(w http.ResponseWriter, accessToken, refreshToken string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	csrfToken := hex.EncodeToString(b)
+
+	cfg.setAccessCookie(w, accessToken)
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshCookie,
+		Value:    refreshToken,
+		Path:     "/api",
+		MaxAge:   int(cfg.RefreshTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	// readable by the web app, which copies it into the X-CSRF-Token header
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   int(cfg.RefreshTokenTTL.Seconds()),
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return csrfToken, nil
+}
+
+func (cfg *Config) setAccessCookie(w http.ResponseWriter, accessToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     AccessCookie,
+		Value:    accessToken,
+		Path:     "/",
+		MaxAge:   int(cfg.AccessTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	for name, path := range map[string]string{AccessCookie: "/", RefreshCookie: "/api", CSRFCookie: "/"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     path,
+			MaxAge:   -1,
+			HttpOnly: name != CSRFCookie,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// MiddlewareCSRF rejects state-changing requests that carry session cookies
+// but no matching X-CSRF-Token header. Requests authenticating with a bearer
+// token are left alone: a cross-site page can't make the browser add one. Any
+// other Authorization header doesn't count, as the cookies would be what
+// authenticates the request.
+func (cfg *Config) MiddlewareCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := bearerToken(r); err == nil || !hasSessionCookie(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get(CSRFHeader)
+		cookie, err := r.Cookie(CSRFCookie)
+		if err != nil || header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+			loggerFrom(r.Context()).Infow("csrf token missing or mismatched")
+			respondError(w, r, newError(http.StatusForbidden, CodeCSRFFailed, "missing or invalid CSRF token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasSessionCookie(r *http.Request) bool {
+	for _, name := range []string{AccessCookie, RefreshCookie} {
+		if c, err := r.Cookie(name); err == nil && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareCSRF(t *testing.T) {
+	cfg := &Config{CookieSessions: true}
+	handler := cfg.MiddlewareCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		cookies       bool
+		csrfHeader    string
+		want          int
+	}{
+		{name: "safe method", method: http.MethodGet, cookies: true, want: http.StatusNoContent},
+		{name: "no session", method: http.MethodPost, want: http.StatusNoContent},
+		{name: "bearer token", method: http.MethodPost, authorization: "Bearer abc", cookies: true, want: http.StatusNoContent},
+		{name: "matching csrf header", method: http.MethodPost, cookies: true, csrfHeader: "csrf", want: http.StatusNoContent},
+		{name: "missing csrf header", method: http.MethodPost, cookies: true, want: http.StatusForbidden},
+		{name: "wrong csrf header", method: http.MethodDelete, cookies: true, csrfHeader: "nope", want: http.StatusForbidden},
+		// these fall back to cookie auth in requestToken, so they need the
+		// csrf header like any cookie request
+		{name: "non-bearer authorization", method: http.MethodPost, authorization: "x", cookies: true, want: http.StatusForbidden},
+		{name: "api key authorization", method: http.MethodPost, authorization: "ApiKey abc", cookies: true, want: http.StatusForbidden},
+		{name: "empty bearer token", method: http.MethodPost, authorization: "Bearer ", cookies: true, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/chirps", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.cookies {
+				r.AddCookie(&http.Cookie{Name: AccessCookie, Value: "access"})
+				r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: "csrf"})
+			}
+			if tt.csrfHeader != "" {
+				r.Header.Set(CSRFHeader, tt.csrfHeader)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
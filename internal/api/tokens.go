@@ -0,0 +1,243 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/authz"
+	"chirpy/internal/database"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const CodeInsufficientScope = "insufficient_scope"
+
+// maxTokenLifetime caps expires_in_days; tokens can also be created without
+// an expiry.
+const maxTokenLifetime = 365
+
+type personalAccessTokenResponse struct {
+	Id         string   `json:"id"`
+	CreatedAt  string   `json:"created_at"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	TokenHint  string   `json:"token_hint"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	// Token is only ever returned once, when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+func newPersonalAccessTokenResponse(pat database.PersonalAccessToken) personalAccessTokenResponse {
+	response := personalAccessTokenResponse{
+		Id:        pat.ID.String(),
+		CreatedAt: pat.CreatedAt.UTC().Format(time.RFC3339),
+		Name:      pat.Name,
+		Scopes:    strings.Fields(pat.Scopes),
+		TokenHint: pat.TokenHint,
+	}
+	if pat.ExpiresAt.Valid {
+		response.ExpiresAt = pat.ExpiresAt.Time.UTC().Format(time.RFC3339)
+	}
+	if pat.LastUsedAt.Valid {
+		response.LastUsedAt = pat.LastUsedAt.Time.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+// authenticatePersonalAccessToken looks up a personal access token and
+// checks it is still usable.
+func (cfg *Config) authenticatePersonalAccessToken(r *http.Request, token string) (database.PersonalAccessToken, *Error) {
+	logger := loggerFrom(r.Context())
+
+	pat, err := cfg.DbQueries.FindPersonalAccessTokenByHash(r.Context(), auth.HashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Infow("personal access token not found")
+			return database.PersonalAccessToken{}, errUnauthorized("missing or invalid access token")
+		}
+		logger.Errorw("finding personal access token", "error", err)
+		return database.PersonalAccessToken{}, errInternal()
+	}
+	if pat.RevokedAt.Valid {
+		logger.Infow("personal access token revoked", "token_id", pat.ID)
+		return database.PersonalAccessToken{}, errUnauthorized("missing or invalid access token")
+	}
+	if pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time) {
+		logger.Infow("personal access token expired", "token_id", pat.ID)
+		return database.PersonalAccessToken{}, newError(http.StatusUnauthorized, CodeTokenExpired, "personal access token has expired")
+	}
+
+	if err := cfg.DbQueries.TouchPersonalAccessToken(r.Context(), pat.ID); err != nil {
+		logger.Warnw("recording personal access token use", "error", err)
+	}
+	return pat, nil
+}
+
+func (cfg *Config) CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// tokens can only be minted from a real session, never by another token;
+	// CanManageAccount refuses personal access tokens
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+	userId := principal.UserID
+
+	type parameters struct {
+		Name          string   `json:"name" validate:"required,max=100"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	params := parameters{}
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
+		return
+	}
+
+	fields := []FieldError{}
+	scopes := []string{}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(authz.Scopes, scope) {
+			fields = append(fields, FieldError{Field: "scopes", Code: "unknown_scope",
+				Message: "unknown scope " + scope + ", expected one of " + strings.Join(authz.Scopes, ", ")})
+			continue
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(params.Scopes) == 0 {
+		fields = append(fields, FieldError{Field: "scopes", Code: "required", Message: "scopes is required"})
+	}
+	if params.ExpiresInDays < 0 || params.ExpiresInDays > maxTokenLifetime {
+		fields = append(fields, FieldError{Field: "expires_in_days", Code: "out_of_range",
+			Message: "expires_in_days must be between 1 and 365, or 0 for no expiry"})
+	}
+	if len(fields) > 0 {
+		respondError(w, r, errValidation(fields...))
+		return
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		logger.Errorw("creating personal access token", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays).UTC(), Valid: true}
+	}
+
+	pat, err := cfg.DbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userId,
+		Name:      params.Name,
+		TokenHash: auth.HashToken(token),
+		TokenHint: token[len(token)-4:],
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		logger.Errorw("storing personal access token", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	response := newPersonalAccessTokenResponse(pat)
+	response.Token = token
+
+	cfg.audit(r, auditEvent{action: AuditTokenCreate, outcome: OutcomeSuccess, actor: userId, subject: userId,
+		target: pat.ID.String(), details: map[string]string{"name": pat.Name, "scopes": pat.Scopes}})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (cfg *Config) ListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+	userId := principal.UserID
+
+	tokens, err := cfg.DbQueries.ListPersonalAccessTokens(r.Context(), userId)
+	if err != nil {
+		logger.Errorw("listing personal access tokens", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+
+	response := struct {
+		Tokens []personalAccessTokenResponse `json:"items"`
+	}{
+		Tokens: []personalAccessTokenResponse{},
+	}
+	for _, pat := range tokens {
+		response.Tokens = append(response.Tokens, newPersonalAccessTokenResponse(pat))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (cfg *Config) RevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+	userId := principal.UserID
+
+	tokenId, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondError(w, r, errBadRequest("token id must be a UUID"))
+		return
+	}
+
+	revoked, err := cfg.DbQueries.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenId,
+		UserID: userId,
+	})
+	if err != nil {
+		logger.Errorw("revoking personal access token", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if revoked == 0 {
+		respondError(w, r, errNotFound("token not found"))
+		return
+	}
+	cfg.audit(r, auditEvent{action: AuditTokenRevoke, outcome: OutcomeSuccess, actor: userId, subject: userId,
+		target: tokenId.String()})
+
+	w.WriteHeader(http.StatusNoContent)
+}
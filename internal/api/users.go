@@ -1,47 +1,77 @@
 package api
 
 import (
-	"chirpy/internal/auth"
+	"archive/zip"
+	"bytes"
+	"chirpy/internal/authz"
 	"chirpy/internal/database"
+	"context"
+	"database/sql"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
-	"os"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 func (cfg *Config) CreateUser(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password    string `json:"password" validate:"required"`
+		Email       string `json:"email" validate:"required,email,max=254"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarUrl   string `json:"avatar_url"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+	if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	handle := strings.ToLower(params.Handle)
+	if handle == "" {
+		handle = DefaultHandle()
+	}
+	fields := ValidateProfile(handle, params.DisplayName, params.Bio, params.AvatarUrl)
+	passwordFields, apiErr := cfg.checkPassword(r.Context(), params.Password, params.Email, handle)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if fields = append(fields, passwordFields...); len(fields) > 0 {
+		respondError(w, r, errValidation(fields...))
+		return
+	}
+
+	hashedPassword, err := cfg.Passwords.Hash(params.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("hashing password", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
 	user, err := cfg.DbQueries.CreateUser(r.Context(), database.CreateUserParams{
 		Email:          params.Email,
-		HashedPassword: hashedPassword,
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+		Handle:         handle,
+		DisplayName:    params.DisplayName,
+		Bio:            params.Bio,
+		AvatarUrl:      params.AvatarUrl,
 	})
 	if err != nil {
-		log.Printf("creating user in db: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		if isUniqueViolation(err) {
+			respondError(w, r, newError(http.StatusConflict, CodeConflict, "email or handle is already taken"))
+			return
+		}
+		logger.Errorw("creating user in db", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
@@ -51,84 +81,320 @@ func (cfg *Config) CreateUser(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt   string `json:"updated_at"`
 		Email       string `json:"email"`
 		IsChirpyRed bool   `json:"is_chirpy_red"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarUrl   string `json:"avatar_url"`
 	}{
 		Id:          user.ID.String(),
 		CreatedAt:   user.CreatedAt.UTC().Format(time.RFC3339),
 		UpdatedAt:   user.UpdatedAt.UTC().Format(time.RFC3339),
 		Email:       user.Email,
 		IsChirpyRed: user.IsChirpyRed,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
 	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
 
-func (cfg *Config) UpdateUserLogin(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("extracting auth header")
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+func (cfg *Config) DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
 		return
 	}
-
-	userId, err := auth.ValidateJWT(accessToken, os.Getenv("JWT_SIGNING_KEY"))
-	if err != nil {
-		log.Printf("validating token: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
 		return
 	}
+	userId := principal.UserID
 
+	// users without a password may send no body at all
 	type parameters struct {
 		Password string `json:"password"`
-		Email    string `json:"email"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	if r.ContentLength != 0 {
+		if apiErr := decodeJSON(w, r, &params); apiErr != nil {
+			logger.Infow("decoding parameters", "error", apiErr)
+			respondError(w, r, apiErr)
+			return
+		}
+	}
+
+	user, err := cfg.DbQueries.FindUserById(r.Context(), userId)
 	if err != nil {
-		log.Printf("decoding parameters: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		if err == sql.ErrNoRows {
+			respondError(w, r, errNotFound("user not found"))
+			return
+		}
+		logger.Errorw("finding user by id", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if reason, apiErr := cfg.confirmIdentity(r, principal, user, "password", params.Password); apiErr != nil {
+		cfg.audit(r, auditEvent{action: AuditAccountDelete, outcome: OutcomeFailure, actor: userId, subject: userId,
+			details: map[string]string{"reason": reason}})
+		respondError(w, r, apiErr)
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
 	if err != nil {
-		log.Printf("hashing password: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("beginning transaction", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
+	defer tx.Rollback()
 
-	user, err := cfg.DbQueries.UpdateUserLogin(r.Context(), database.UpdateUserLoginParams{
-		ID:             userId,
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-	})
+	q := cfg.DbQueries.InTx(tx)
+	owner := uuid.NullUUID{UUID: userId, Valid: true}
+	if err := q.RevokeAllRefreshTokensForUser(r.Context(), owner); err != nil {
+		logger.Errorw("revoking refresh tokens", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if err := q.RevokeAllPersonalAccessTokensForUser(r.Context(), userId); err != nil {
+		logger.Errorw("revoking personal access tokens", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if err := q.DeleteChirpsByUser(r.Context(), owner); err != nil {
+		logger.Errorw("deleting chirps of user", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	// the user row is only soft deleted, so these would otherwise let a
+	// social sign-in or a pending email link find the account again
+	if err := q.DeleteUserIdentitiesByUser(r.Context(), userId); err != nil {
+		logger.Errorw("deleting identities of user", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if err := q.DeleteEmailChangesByUser(r.Context(), userId); err != nil {
+		logger.Errorw("deleting email changes of user", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if err := q.DeleteUser(r.Context(), userId); err != nil {
+		logger.Errorw("deleting user", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Errorw("committing user deletion", "error", err)
+		respondError(w, r, errInternal())
+		return
+	}
+	cfg.audit(r, auditEvent{action: AuditAccountDelete, outcome: OutcomeSuccess, actor: userId, subject: userId})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *Config) ExportCurrentUser(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
+	// validate auth before processing any further
+	principal, apiErr := cfg.authenticate(r)
+	if apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+	if err := authz.CanManageAccount(principal, principal.UserID); err != nil {
+		logger.Infow("request denied", "error", err)
+		respondError(w, r, errDenied(err))
+		return
+	}
+	userId := principal.UserID
+
+	archive, err := cfg.buildUserExport(r.Context(), userId)
 	if err != nil {
-		log.Printf("updating user login in db: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		if err == sql.ErrNoRows {
+			respondError(w, r, errNotFound("user not found"))
+			return
+		}
+		logger.Errorw("building user export", "error", err)
+		respondError(w, r, errInternal())
 		return
 	}
 
-	response := struct {
+	filename := fmt.Sprintf("chirpy-export-%s.zip", time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// buildUserExport collects everything we store about a user into a zip
+// archive of JSON documents. Refresh and personal access tokens are exported
+// as metadata only; the token values themselves are secrets and stay out of
+// the archive. Chirpy has no reactions or media uploads yet, so there is
+// nothing of either to export; they belong here once they exist.
+func (cfg *Config) buildUserExport(ctx context.Context, userId uuid.UUID) ([]byte, error) {
+	user, err := cfg.DbQueries.FindUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	owner := uuid.NullUUID{UUID: userId, Valid: true}
+	chirps, err := cfg.DbQueries.ListAllChirpsByUser(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("listing chirps: %w", err)
+	}
+	tokens, err := cfg.DbQueries.ListRefreshTokensForUser(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	pats, err := cfg.DbQueries.ListPersonalAccessTokens(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("listing access tokens: %w", err)
+	}
+	identities, err := cfg.DbQueries.ListUserIdentities(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("listing linked accounts: %w", err)
+	}
+	events, err := cfg.listAllSecurityEvents(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("listing security events: %w", err)
+	}
+
+	type exportedChirp struct {
+		Id          string  `json:"id"`
+		CreatedAt   string  `json:"created_at"`
+		UpdatedAt   string  `json:"updated_at"`
+		Body        string  `json:"body"`
+		PublishAt   *string `json:"publish_at"`
+		PublishedAt *string `json:"published_at"`
+		DeletedAt   *string `json:"deleted_at"`
+	}
+	type exportedSession struct {
+		CreatedAt string  `json:"created_at"`
+		ExpiresAt string  `json:"expires_at"`
+		RevokedAt *string `json:"revoked_at"`
+	}
+	type exportedIdentity struct {
+		Provider    string `json:"provider"`
+		Subject     string `json:"subject"`
+		Email       string `json:"email"`
+		CreatedAt   string `json:"created_at"`
+		LastLoginAt string `json:"last_login_at"`
+	}
+
+	profile := struct {
 		Id          string `json:"id"`
 		CreatedAt   string `json:"created_at"`
 		UpdatedAt   string `json:"updated_at"`
 		Email       string `json:"email"`
-		IsChirpyRed bool   `json:"is_chirpy_red"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		AvatarUrl   string `json:"avatar_url"`
 	}{
 		Id:          user.ID.String(),
 		CreatedAt:   user.CreatedAt.UTC().Format(time.RFC3339),
 		UpdatedAt:   user.UpdatedAt.UTC().Format(time.RFC3339),
 		Email:       user.Email,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarUrl:   user.AvatarUrl,
+	}
+	subscription := struct {
+		Plan        string `json:"plan"`
+		IsChirpyRed bool   `json:"is_chirpy_red"`
+	}{
+		Plan:        "free",
 		IsChirpyRed: user.IsChirpyRed,
 	}
+	if user.IsChirpyRed {
+		subscription.Plan = "chirpy_red"
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	exportedChirps := make([]exportedChirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		exportedChirps = append(exportedChirps, exportedChirp{
+			Id:          chirp.ID.String(),
+			CreatedAt:   chirp.CreatedAt.UTC().Format(time.RFC3339),
+			UpdatedAt:   chirp.UpdatedAt.UTC().Format(time.RFC3339),
+			Body:        chirp.Body,
+			PublishAt:   formatNullTime(chirp.PublishAt),
+			PublishedAt: formatNullTime(chirp.PublishedAt),
+			DeletedAt:   formatNullTime(chirp.DeletedAt),
+		})
+	}
+	sessions := make([]exportedSession, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, exportedSession{
+			CreatedAt: token.CreatedAt.UTC().Format(time.RFC3339),
+			ExpiresAt: token.ExpiresAt.UTC().Format(time.RFC3339),
+			RevokedAt: formatNullTime(token.RevokedAt),
+		})
+	}
+
+	accessTokens := make([]personalAccessTokenResponse, 0, len(pats))
+	for _, pat := range pats {
+		accessTokens = append(accessTokens, newPersonalAccessTokenResponse(pat))
+	}
+	linkedAccounts := make([]exportedIdentity, 0, len(identities))
+	for _, identity := range identities {
+		linkedAccounts = append(linkedAccounts, exportedIdentity{
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt.UTC().Format(time.RFC3339),
+			LastLoginAt: identity.LastLoginAt.UTC().Format(time.RFC3339),
+		})
+	}
+	securityEvents := make([]auditEventResponse, 0, len(events))
+	for _, event := range events {
+		securityEvents = append(securityEvents, newSecurityEventResponse(event))
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", profile},
+		{"chirps.json", exportedChirps},
+		{"sessions.json", sessions},
+		{"access_tokens.json", accessTokens},
+		{"linked_accounts.json", linkedAccounts},
+		{"security_events.json", securityEvents},
+		{"subscription.json", subscription},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("adding %s: %w", f.name, err)
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("finishing archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func formatNullTime(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	s := t.Time.UTC().Format(time.RFC3339)
+	return &s
 }
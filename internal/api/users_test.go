@@ -0,0 +1,73 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/dbtest"
+	"chirpy/internal/migrate"
+	"chirpy/sql/schema"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeleteCurrentUserPasswordless(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	migrator, err := migrate.New(db, schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{DB: db, DbQueries: database.New(db), JwtSigningSecret: "secret"}
+
+	user, err := cfg.DbQueries.CreateUser(ctx, database.CreateUserParams{
+		Email:  "social@example.com",
+		Handle: "social",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.DbQueries.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: "mock",
+		Subject:  "subject-1",
+		UserID:   user.ID,
+		Email:    user.Email,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DbQueries.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+		UserID:    user.ID,
+		NewEmail:  "new@example.com",
+		TokenHash: "hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.JwtSigningSecret, time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no body and no content type, as the comment in the handler promises
+	r := httptest.NewRequest(http.MethodDelete, "/api/users/me", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.DeleteCurrentUser(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	if _, err := cfg.DbQueries.FindUserIdentity(ctx, database.FindUserIdentityParams{Provider: "mock", Subject: "subject-1"}); err == nil {
+		t.Error("identity outlived the account, a social sign-in could find it again")
+	}
+	if _, err := cfg.DbQueries.FindEmailChangeByHash(ctx, "hash"); err == nil {
+		t.Error("pending email change outlived the account")
+	}
+}
@@ -2,50 +2,47 @@ package api
 
 import (
 	"chirpy/internal/auth"
-	"database/sql"
-	"encoding/json"
-	"log"
+	"chirpy/internal/metrics"
+	"crypto/subtle"
 	"net/http"
 
 	"github.com/google/uuid"
 )
 
 func (cfg *Config) UpgradeUser(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFrom(r.Context())
+
 	apiKey, err := auth.GetAPIKey(r.Header)
 	if err != nil {
-		log.Printf("extracting API Key: %s", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+		logger.Infow("extracting API Key", "error", err)
+		respondError(w, r, errUnauthorized("missing or invalid API key"))
 		return
 	}
 
-	if apiKey != cfg.PolkaKey {
-		log.Printf("api key doesn't match expected Polka api key")
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("UNAUTHORIZED"))
+	if cfg.PolkaKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.PolkaKey)) != 1 {
+		logger.Infow("api key doesn't match expected Polka api key")
+		respondError(w, r, errUnauthorized("missing or invalid API key"))
 		return
 	}
 
 	type Data struct {
-		UserId string `json:"user_id"`
+		UserId string `json:"user_id" validate:"uuid"`
 	}
 	type parameters struct {
-		Event string `json:"event"`
+		Event string `json:"event" validate:"required"`
 		Data  Data   `json:"data"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		log.Printf("decoding parameters: %s", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("BAD REQUEST"))
+	if apiErr := decodeJSONLenient(w, r, &params); apiErr != nil {
+		logger.Infow("decoding parameters", "error", apiErr)
+		respondError(w, r, apiErr)
 		return
 	}
 
 	if params.Event != "user.upgraded" {
-		log.Printf("ignoring event: %s", params.Event)
+		logger.Infow("ignoring event", "event", params.Event)
+		metrics.WebhooksProcessed.WithLabelValues("other", "ignored").Inc()
 		w.WriteHeader(http.StatusNoContent)
 		w.Write([]byte("NO CONTENT"))
 		return
@@ -53,25 +50,33 @@ func (cfg *Config) UpgradeUser(w http.ResponseWriter, r *http.Request) {
 
 	userUUID, err := uuid.Parse(params.Data.UserId)
 	if err != nil {
-		log.Printf("parsing uuid: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Infow("upgrade event without a user id", "error", err)
+		respondError(w, r, errValidation(FieldError{
+			Field:   "data.user_id",
+			Code:    "required",
+			Message: "data.user_id is required",
+		}))
 		return
 	}
 
-	err = cfg.DbQueries.UpgradeUser(r.Context(), userUUID)
+	upgraded, err := cfg.DbQueries.UpgradeUser(r.Context(), userUUID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("unable to find user for upgrade: %s", userUUID)
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("NOT FOUND"))
-			return
-		}
-		log.Printf("upgrading user in db: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("INTERNAL SERVER ERROR"))
+		logger.Errorw("upgrading user in db", "error", err)
+		metrics.WebhooksProcessed.WithLabelValues(params.Event, "error").Inc()
+		respondError(w, r, errInternal())
+		return
+	}
+	if upgraded == 0 {
+		logger.Infow("unable to find user for upgrade", "user_id", userUUID)
+		metrics.WebhooksProcessed.WithLabelValues(params.Event, "not_found").Inc()
+		cfg.audit(r, auditEvent{action: AuditUpgrade, outcome: OutcomeFailure, target: userUUID.String(),
+			details: map[string]string{"source": "polka", "event": params.Event, "reason": "user_not_found"}})
+		respondError(w, r, errNotFound("user not found"))
 		return
 	}
 
+	metrics.WebhooksProcessed.WithLabelValues(params.Event, "upgraded").Inc()
+	cfg.audit(r, auditEvent{action: AuditUpgrade, outcome: OutcomeSuccess, subject: userUUID,
+		details: map[string]string{"source": "polka", "event": params.Event}})
 	w.WriteHeader(http.StatusNoContent)
 }
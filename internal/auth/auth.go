@@ -2,40 +2,40 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hash), nil
+// accessClaims are the claims of an access token. AuthTime is when the user
+// last proved who they are by signing in; refreshed tokens keep it.
+type accessClaims struct {
+	jwt.StandardClaims
+	AuthTime int64 `json:"auth_time,omitempty"`
 }
 
-func CheckPasswordHash(password string, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err
-}
+// accessTokenIssuer tells access tokens apart from other JWTs signed with
+// the same secret, like the sealed sign-in flows of package oidc.
+const accessTokenIssuer = "chirpy"
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, authTime time.Time) (string, error) {
 	now := time.Now()
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  now.Unix(),
-		ExpiresAt: now.Add(expiresIn).Unix(),
-		Subject:   userID.String(),
-	}).SignedString([]byte(os.Getenv("JWT_SIGNING_KEY")))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    accessTokenIssuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiresIn).Unix(),
+			Subject:   userID.String(),
+		},
+		AuthTime: authTime.Unix(),
+	}).SignedString([]byte(tokenSecret))
 	if err != nil {
 		log.Printf("Error while creating and signing JWT")
 		return "", err
@@ -43,7 +43,9 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return token, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// ValidateJWT returns the user an access token was issued to and when they
+// signed in. Tokens from before auth_time was added report the zero time.
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, time.Time, error) {
 	claims := jwt.MapClaims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -53,29 +55,36 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	})
 
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("parsing token: %w", err)
+		return uuid.Nil, time.Time{}, fmt.Errorf("parsing token: %w", err)
 	}
 
 	if !token.Valid {
-		return uuid.Nil, fmt.Errorf("token validation failed")
+		return uuid.Nil, time.Time{}, fmt.Errorf("token validation failed")
+	}
+	if !claims.VerifyIssuer(accessTokenIssuer, true) {
+		return uuid.Nil, time.Time{}, fmt.Errorf("not an access token")
 	}
 
 	sub, ok := claims["sub"]
 	if !ok {
-		return uuid.Nil, fmt.Errorf("missing subject claim")
+		return uuid.Nil, time.Time{}, fmt.Errorf("missing subject claim")
 	}
 
 	subStr, ok := sub.(string)
 	if !ok {
-		return uuid.Nil, fmt.Errorf("subject claim is not a string")
+		return uuid.Nil, time.Time{}, fmt.Errorf("subject claim is not a string")
 	}
 
 	userID, err := uuid.Parse(subStr)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("parsing user ID: %w", err)
+		return uuid.Nil, time.Time{}, fmt.Errorf("parsing user ID: %w", err)
 	}
 
-	return userID, nil
+	var authTime time.Time
+	if at, ok := claims["auth_time"].(float64); ok {
+		authTime = time.Unix(int64(at), 0)
+	}
+	return userID, authTime, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -83,11 +92,10 @@ func GetBearerToken(headers http.Header) (string, error) {
 	if auth == "" {
 		return "", fmt.Errorf("authorization header missing")
 	}
-	if !strings.Contains(auth, "Bearer ") {
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || token == "" {
 		return "", fmt.Errorf("invalid Bearer token format")
 	}
-
-	token := strings.Split(auth, " ")[1]
 	return token, nil
 }
 
@@ -106,10 +114,28 @@ func GetAPIKey(headers http.Header) (string, error) {
 	if apiKey == "" {
 		return "", fmt.Errorf("authorization header missing")
 	}
-	if !strings.Contains(apiKey, "ApiKey") {
+	key, ok := strings.CutPrefix(apiKey, "ApiKey ")
+	if !ok || key == "" {
 		return "", fmt.Errorf("invalid ApiKey key format")
 	}
-
-	key := strings.Split(apiKey, " ")[1]
 	return key, nil
 }
+
+// PersonalAccessTokenPrefix marks personal access tokens, so the auth path
+// can tell them apart from JWTs and secret scanners can spot leaked ones.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+// HashToken is how personal access tokens are stored. They are 32 random
+// bytes, so unlike passwords a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
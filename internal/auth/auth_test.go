@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+func TestValidateJWT(t *testing.T) {
+	userID := uuid.New()
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	sign := func(t *testing.T, secret string, claims jwt.Claims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	claims := func(issuer string, expiresIn time.Duration) jwt.StandardClaims {
+		return jwt.StandardClaims{
+			Issuer:    issuer,
+			Subject:   userID.String(),
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(expiresIn).Unix(),
+		}
+	}
+
+	valid, err := MakeJWT(userID, "secret", time.Hour, authTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"access token", valid, false},
+		{"wrong secret", sign(t, "other", claims(accessTokenIssuer, time.Hour)), true},
+		{"expired", sign(t, "secret", claims(accessTokenIssuer, -time.Minute)), true},
+		// sealed sign-in flows share the secret; only the issuer sets them apart
+		{"other issuer", sign(t, "secret", claims("chirpy-oidc-flow", time.Hour)), true},
+		{"no issuer", sign(t, "secret", claims("", time.Hour)), true},
+		{"garbage", "not.a.jwt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID, gotAuthTime, err := ValidateJWT(tt.token, "secret")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotID != userID || !gotAuthTime.Equal(authTime) {
+				t.Errorf("got %s at %s, want %s at %s", gotID, gotAuthTime, userID, authTime)
+			}
+		})
+	}
+}
+
+func TestAuthorizationHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		get    func(http.Header) (string, error)
+		want   string
+		// wantErr is set for headers that must be rejected
+		wantErr bool
+	}{
+		{"bearer token", "Bearer abc", GetBearerToken, "abc", false},
+		{"missing bearer header", "", GetBearerToken, "", true},
+		{"bearer without token", "Bearer", GetBearerToken, "", true},
+		{"empty bearer token", "Bearer ", GetBearerToken, "", true},
+		{"bearer not a prefix", "xBearer abc", GetBearerToken, "", true},
+		{"api key instead of bearer", "ApiKey abc", GetBearerToken, "", true},
+
+		{"api key", "ApiKey abc", GetAPIKey, "abc", false},
+		{"missing api key header", "", GetAPIKey, "", true},
+		{"api key without key", "ApiKey", GetAPIKey, "", true},
+		{"empty api key", "ApiKey ", GetAPIKey, "", true},
+		{"api key not a prefix", "xApiKey abc", GetAPIKey, "", true},
+		{"bearer instead of api key", "Bearer abc", GetAPIKey, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := http.Header{}
+			if tt.header != "" {
+				headers.Set("Authorization", tt.header)
+			}
+			got, err := tt.get(headers)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("accepted %q as %q", tt.header, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
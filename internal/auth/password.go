@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password does not match")
+	ErrUnknownHash      = errors.New("unrecognised password hash format")
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordParams are the Argon2id cost parameters. Memory is in KiB.
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultPasswordParams follow the OWASP recommendation for Argon2id.
+var DefaultPasswordParams = PasswordParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+}
+
+// PasswordHasher hashes new passwords with Argon2id, encoded in the PHC
+// string format so the parameters travel with each hash:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+//
+// It still verifies bcrypt hashes from before the switch, and reports when
+// a hash should be replaced because it is bcrypt or was made with other
+// parameters.
+type PasswordHasher struct {
+	Params PasswordParams
+}
+
+func (h PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks password against hash. When it matches, rehash reports
+// whether the caller should store a fresh Hash of the password.
+func (h PasswordHasher) Verify(password, hash string) (rehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, err
+		}
+		got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, ErrPasswordMismatch
+		}
+		return params != h.Params || len(salt) != argon2SaltLength || len(key) != argon2KeyLength, nil
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		// bcrypt only looks at the first 72 bytes, so longer passwords
+		// can't be told apart from their prefix; refuse them outright
+		if len(password) > 72 {
+			return false, ErrPasswordMismatch
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrPasswordMismatch
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	default:
+		return false, ErrUnknownHash
+	}
+}
+
+func decodeArgon2(hash string) (PasswordParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return PasswordParams{}, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return PasswordParams{}, nil, nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnknownHash, parts[2])
+	}
+
+	params := PasswordParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return PasswordParams{}, nil, nil, fmt.Errorf("%w: bad argon2 parameters: %v", ErrUnknownHash, err)
+	}
+	// argon2 panics on zero iterations or parallelism
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return PasswordParams{}, nil, nil, fmt.Errorf("%w: bad argon2 parameters %q", ErrUnknownHash, parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return PasswordParams{}, nil, nil, fmt.Errorf("%w: bad argon2 salt: %v", ErrUnknownHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return PasswordParams{}, nil, nil, fmt.Errorf("%w: bad argon2 key", ErrUnknownHash)
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keep the tests fast; production costs come from config.
+var testParams = PasswordParams{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestPasswordHasher(t *testing.T) {
+	hasher := PasswordHasher{Params: testParams}
+	long := strings.Repeat("a", 72) + "tail"
+
+	argon2Hash := func(t *testing.T, params PasswordParams, password string) string {
+		t.Helper()
+		hash, err := PasswordHasher{Params: params}.Hash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	bcryptHash := func(t *testing.T, password string) string {
+		t.Helper()
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(hash)
+	}
+
+	tests := []struct {
+		name     string
+		hash     func(t *testing.T) string
+		password string
+		// wantErr is nil when the password should verify
+		wantErr    error
+		wantRehash bool
+	}{
+		{
+			name:     "argon2id round trip",
+			hash:     func(t *testing.T) string { return argon2Hash(t, testParams, "hunter22") },
+			password: "hunter22",
+		},
+		{
+			name:     "argon2id wrong password",
+			hash:     func(t *testing.T) string { return argon2Hash(t, testParams, "hunter22") },
+			password: "hunter23",
+			wantErr:  ErrPasswordMismatch,
+		},
+		{
+			name:     "argon2id password longer than 72 bytes",
+			hash:     func(t *testing.T) string { return argon2Hash(t, testParams, long) },
+			password: long,
+		},
+		{
+			name:     "argon2id only the first 72 bytes",
+			hash:     func(t *testing.T) string { return argon2Hash(t, testParams, long) },
+			password: long[:72],
+			wantErr:  ErrPasswordMismatch,
+		},
+		{
+			name: "argon2id with changed parameters",
+			hash: func(t *testing.T) string {
+				return argon2Hash(t, PasswordParams{Memory: 32, Iterations: 2, Parallelism: 1}, "hunter22")
+			},
+			password:   "hunter22",
+			wantRehash: true,
+		},
+		{
+			name:       "bcrypt fallback",
+			hash:       func(t *testing.T) string { return bcryptHash(t, "hunter22") },
+			password:   "hunter22",
+			wantRehash: true,
+		},
+		{
+			name:     "bcrypt wrong password",
+			hash:     func(t *testing.T) string { return bcryptHash(t, "hunter22") },
+			password: "hunter23",
+			wantErr:  ErrPasswordMismatch,
+		},
+		{
+			name:     "bcrypt password longer than 72 bytes",
+			hash:     func(t *testing.T) string { return bcryptHash(t, long[:72]) },
+			password: long,
+			wantErr:  ErrPasswordMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := hasher.Verify(tt.password, tt.hash(t))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if rehash != tt.wantRehash {
+				t.Errorf("rehash = %v, want %v", rehash, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherHash(t *testing.T) {
+	hash, err := PasswordHasher{Params: testParams}.Hash("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash %q doesn't carry its parameters", hash)
+	}
+	again, err := PasswordHasher{Params: testParams}.Hash("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == hash {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestPasswordHasherMalformed(t *testing.T) {
+	hasher := PasswordHasher{Params: testParams}
+	valid, err := hasher.Hash("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, "$")
+	with := func(i int, value string) string {
+		changed := append([]string{}, parts...)
+		changed[i] = value
+		return strings.Join(changed, "$")
+	}
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"unknown scheme", "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5"},
+		{"plain text", "hunter22"},
+		{"truncated", valid[:strings.LastIndex(valid, "$")]},
+		{"missing key", with(5, "")},
+		{"missing salt", with(4, "")},
+		{"extra field", valid + "$extra"},
+		{"unsupported version", with(2, "v=16")},
+		{"garbled version", with(2, "version")},
+		{"garbled parameters", with(3, "m=64;t=1;p=1")},
+		{"zero iterations", with(3, "m=64,t=0,p=1")},
+		{"zero parallelism", with(3, "m=64,t=1,p=0")},
+		{"parallelism out of range", with(3, "m=64,t=1,p=256")},
+		{"salt not base64", with(4, "not base64!")},
+		{"key not base64", with(5, "not base64!")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := hasher.Verify("hunter22", tt.hash)
+			if !errors.Is(err, ErrUnknownHash) {
+				t.Errorf("err = %v, want %v", err, ErrUnknownHash)
+			}
+			if rehash {
+				t.Error("malformed hash asked for a rehash")
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// Package authz decides what an authenticated caller may do. Every rule
+// lives here so handlers don't compare ids and roles on their own; a policy
+// returns nil to allow an action, or a *Denial explaining why not.
+package authz
+
+import (
+	"chirpy/internal/database"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Scopes a personal access token can be granted. They are part of the API
+// contract, so existing ones must never be renamed.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var Scopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// Principal is whoever is making the request. The zero value is an
+// anonymous caller.
+type Principal struct {
+	UserID uuid.UUID
+	Role   string
+	// Suspended is set for disabled accounts, which may still read public
+	// data but not act.
+	Suspended bool
+	// Token is set when the caller used a personal access token rather
+	// than a login session, limiting them to Scopes.
+	Token  bool
+	Scopes []string
+	// AuthTime is when the caller signed in to the session they are using.
+	// It is zero for personal access tokens.
+	AuthTime time.Time
+}
+
+func (p Principal) Anonymous() bool {
+	return p.UserID == uuid.Nil
+}
+
+// Reasons a request is denied. Callers map them to responses with
+// errors.Is.
+var (
+	ErrUnauthenticated = errors.New("not authenticated")
+	ErrSuspended       = errors.New("account suspended")
+	ErrScope           = errors.New("insufficient scope")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// Denial is returned by policies. Its message is safe to show the caller.
+type Denial struct {
+	Reason  error
+	Message string
+}
+
+func (d *Denial) Error() string {
+	return d.Message
+}
+
+func (d *Denial) Unwrap() error {
+	return d.Reason
+}
+
+func deny(reason error, format string, args ...any) error {
+	return &Denial{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// act checks what every action needs: a signed in, active user and, for
+// personal access tokens, the given scope. An empty scope means the action
+// needs a login session and no token is good enough.
+func (p Principal) act(scope string) error {
+	if p.Anonymous() {
+		return deny(ErrUnauthenticated, "missing or invalid access token")
+	}
+	if p.Suspended {
+		return deny(ErrSuspended, "this account has been disabled")
+	}
+	if p.Token {
+		if scope == "" {
+			return deny(ErrScope, "personal access tokens can't be used here")
+		}
+		if !slices.Contains(p.Scopes, scope) {
+			return deny(ErrScope, "token lacks the %s scope", scope)
+		}
+	}
+	return nil
+}
+
+func (p Principal) owns(chirp database.Chirp) bool {
+	return chirp.UserID.Valid && chirp.UserID.UUID == p.UserID
+}
+
+// CanCreateChirp allows posting chirps as authorID, which must be the caller
+// themselves.
+func CanCreateChirp(p Principal, authorID uuid.UUID) error {
+	if err := p.act(ScopeChirpsWrite); err != nil {
+		return err
+	}
+	if authorID != p.UserID {
+		return deny(ErrForbidden, "you can only chirp as yourself")
+	}
+	return nil
+}
+
+// CanViewChirp allows anyone to see published chirps. Scheduled ones are
+// only visible to their author until published.
+func CanViewChirp(p Principal, chirp database.Chirp) error {
+	if chirp.PublishedAt.Valid {
+		return nil
+	}
+	if err := p.act(ScopeChirpsRead); err != nil {
+		return err
+	}
+	if !p.owns(chirp) {
+		return deny(ErrForbidden, "chirp is not published")
+	}
+	return nil
+}
+
+// CanListScheduledChirps allows callers to list their own drafts.
+func CanListScheduledChirps(p Principal) error {
+	return p.act(ScopeChirpsRead)
+}
+
+// CanCancelScheduledChirp allows authors to drop their own drafts.
+func CanCancelScheduledChirp(p Principal, chirp database.Chirp) error {
+	if err := p.act(ScopeChirpsWrite); err != nil {
+		return err
+	}
+	if !p.owns(chirp) || chirp.PublishedAt.Valid {
+		return deny(ErrForbidden, "you can only cancel your own scheduled chirps")
+	}
+	return nil
+}
+
+// CanDeleteChirp allows authors to delete their chirps and admins to take
+// down anyone's.
+func CanDeleteChirp(p Principal, chirp database.Chirp) error {
+	if err := p.act(ScopeChirpsWrite); err != nil {
+		return err
+	}
+	if !p.owns(chirp) && p.Role != RoleAdmin {
+		return deny(ErrForbidden, "you can only delete your own chirps")
+	}
+	return nil
+}
+
+// CanRestoreChirp allows authors to bring back chirps they deleted
+// themselves. A chirp taken down by an admin, or whose deletion nobody can
+// account for, stays down unless an admin restores it. Drafts never come
+// back: the scheduler would publish a chirp its author withdrew.
+func CanRestoreChirp(p Principal, chirp database.Chirp) error {
+	if err := p.act(ScopeChirpsWrite); err != nil {
+		return err
+	}
+	if !chirp.PublishedAt.Valid {
+		return deny(ErrForbidden, "cancelled scheduled chirps can't be restored, schedule them again instead")
+	}
+	if p.Role == RoleAdmin {
+		return nil
+	}
+	if !p.owns(chirp) {
+		return deny(ErrForbidden, "you can only restore your own chirps")
+	}
+	if chirp.DeletedByRole.String == RoleAdmin || !chirp.DeletedBy.Valid || chirp.DeletedBy.UUID != p.UserID {
+		return deny(ErrForbidden, "this chirp was removed by a moderator and can't be restored")
+	}
+	return nil
+}
+
+// CanEditProfile allows users to change their public profile.
+func CanEditProfile(p Principal, userID uuid.UUID) error {
+	if err := p.act(ScopeProfileWrite); err != nil {
+		return err
+	}
+	if userID != p.UserID {
+		return deny(ErrForbidden, "you can only edit your own profile")
+	}
+	return nil
+}
+
+// CanManageAccount covers credentials, account deletion, data export and
+// personal access tokens. They need a login session: a leaked bot token
+// must not be able to take over the account.
+func CanManageAccount(p Principal, userID uuid.UUID) error {
+	if err := p.act(""); err != nil {
+		return err
+	}
+	if userID != p.UserID {
+		return deny(ErrForbidden, "you can only manage your own account")
+	}
+	return nil
+}
+
+// CanAdminister allows the admin endpoints.
+func CanAdminister(p Principal) error {
+	if err := p.act(""); err != nil {
+		return err
+	}
+	if p.Role != RoleAdmin {
+		return deny(ErrForbidden, "admin role required")
+	}
+	return nil
+}
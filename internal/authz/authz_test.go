@@ -0,0 +1,126 @@
+package authz
+
+import (
+	"chirpy/internal/database"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	authorID = uuid.New()
+	otherID  = uuid.New()
+	adminID  = uuid.New()
+
+	anonymous = Principal{}
+	author    = Principal{UserID: authorID, Role: RoleUser}
+	other     = Principal{UserID: otherID, Role: RoleUser}
+	admin     = Principal{UserID: adminID, Role: RoleAdmin}
+	suspended = Principal{UserID: authorID, Role: RoleUser, Suspended: true}
+	readToken = Principal{UserID: authorID, Role: RoleUser, Token: true, Scopes: []string{ScopeChirpsRead}}
+	bot       = Principal{UserID: authorID, Role: RoleUser, Token: true, Scopes: Scopes}
+)
+
+func chirp(published bool) database.Chirp {
+	c := database.Chirp{ID: uuid.New(), UserID: uuid.NullUUID{UUID: authorID, Valid: true}}
+	if published {
+		c.PublishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	return c
+}
+
+// deletedBy is a published chirp deleted by id acting in role; a zero id
+// is a deletion nobody recorded.
+func deletedBy(id uuid.UUID, role string) database.Chirp {
+	return deleted(chirp(true), id, role)
+}
+
+func deleted(c database.Chirp, id uuid.UUID, role string) database.Chirp {
+	c.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if id != uuid.Nil {
+		c.DeletedBy = uuid.NullUUID{UUID: id, Valid: true}
+		c.DeletedByRole = sql.NullString{String: role, Valid: true}
+	}
+	return c
+}
+
+func TestPolicies(t *testing.T) {
+	published, scheduled := chirp(true), chirp(false)
+	cancelled := deleted(chirp(false), authorID, RoleUser)
+
+	tests := []struct {
+		name   string
+		policy func(Principal) error
+		p      Principal
+		// want is the reason for the denial, nil when allowed
+		want error
+	}{
+		{"create as self", func(p Principal) error { return CanCreateChirp(p, authorID) }, author, nil},
+		{"create as someone else", func(p Principal) error { return CanCreateChirp(p, otherID) }, author, ErrForbidden},
+		{"create anonymously", func(p Principal) error { return CanCreateChirp(p, uuid.Nil) }, anonymous, ErrUnauthenticated},
+		{"create while suspended", func(p Principal) error { return CanCreateChirp(p, authorID) }, suspended, ErrSuspended},
+		{"create with read token", func(p Principal) error { return CanCreateChirp(p, authorID) }, readToken, ErrScope},
+		{"create with write token", func(p Principal) error { return CanCreateChirp(p, authorID) }, bot, nil},
+
+		{"view published anonymously", func(p Principal) error { return CanViewChirp(p, published) }, anonymous, nil},
+		{"view own scheduled", func(p Principal) error { return CanViewChirp(p, scheduled) }, author, nil},
+		{"view other's scheduled", func(p Principal) error { return CanViewChirp(p, scheduled) }, other, ErrForbidden},
+		{"view scheduled anonymously", func(p Principal) error { return CanViewChirp(p, scheduled) }, anonymous, ErrUnauthenticated},
+		{"view own scheduled with read token", func(p Principal) error { return CanViewChirp(p, scheduled) }, readToken, nil},
+
+		{"list scheduled", CanListScheduledChirps, author, nil},
+		{"list scheduled anonymously", CanListScheduledChirps, anonymous, ErrUnauthenticated},
+
+		{"cancel own scheduled", func(p Principal) error { return CanCancelScheduledChirp(p, scheduled) }, author, nil},
+		{"cancel published", func(p Principal) error { return CanCancelScheduledChirp(p, published) }, author, ErrForbidden},
+		{"cancel other's scheduled", func(p Principal) error { return CanCancelScheduledChirp(p, scheduled) }, other, ErrForbidden},
+		{"cancel with read token", func(p Principal) error { return CanCancelScheduledChirp(p, scheduled) }, readToken, ErrScope},
+
+		{"delete own", func(p Principal) error { return CanDeleteChirp(p, published) }, author, nil},
+		{"delete other's", func(p Principal) error { return CanDeleteChirp(p, published) }, other, ErrForbidden},
+		{"admin takes down", func(p Principal) error { return CanDeleteChirp(p, published) }, admin, nil},
+		{"delete while suspended", func(p Principal) error { return CanDeleteChirp(p, published) }, suspended, ErrSuspended},
+
+		{"restore own deletion", func(p Principal) error { return CanRestoreChirp(p, deletedBy(authorID, RoleUser)) }, author, nil},
+		{"restore own deletion with write token", func(p Principal) error { return CanRestoreChirp(p, deletedBy(authorID, RoleUser)) }, bot, nil},
+		{"restore other's chirp", func(p Principal) error { return CanRestoreChirp(p, deletedBy(authorID, RoleUser)) }, other, ErrForbidden},
+		{"author restores takedown", func(p Principal) error { return CanRestoreChirp(p, deletedBy(adminID, RoleAdmin)) }, author, ErrForbidden},
+		{"author restores unrecorded deletion", func(p Principal) error { return CanRestoreChirp(p, deletedBy(uuid.Nil, "")) }, author, ErrForbidden},
+		{"admin restores takedown", func(p Principal) error { return CanRestoreChirp(p, deletedBy(adminID, RoleAdmin)) }, admin, nil},
+		{"admin restores author's deletion", func(p Principal) error { return CanRestoreChirp(p, deletedBy(authorID, RoleUser)) }, admin, nil},
+		{"author restores cancelled draft", func(p Principal) error { return CanRestoreChirp(p, cancelled) }, author, ErrForbidden},
+		{"admin restores cancelled draft", func(p Principal) error { return CanRestoreChirp(p, cancelled) }, admin, ErrForbidden},
+		{"suspended admin restores", func(p Principal) error { return CanRestoreChirp(p, deletedBy(adminID, RoleAdmin)) },
+			Principal{UserID: adminID, Role: RoleAdmin, Suspended: true}, ErrSuspended},
+
+		{"edit own profile", func(p Principal) error { return CanEditProfile(p, authorID) }, author, nil},
+		{"edit own profile with token", func(p Principal) error { return CanEditProfile(p, authorID) }, bot, nil},
+		{"edit other's profile", func(p Principal) error { return CanEditProfile(p, otherID) }, author, ErrForbidden},
+
+		{"manage own account", func(p Principal) error { return CanManageAccount(p, authorID) }, author, nil},
+		{"manage account with token", func(p Principal) error { return CanManageAccount(p, authorID) }, bot, ErrScope},
+		{"manage other's account", func(p Principal) error { return CanManageAccount(p, otherID) }, admin, ErrForbidden},
+
+		{"administer", CanAdminister, admin, nil},
+		{"administer as user", CanAdminister, author, ErrForbidden},
+		{"administer with admin token", CanAdminister, Principal{UserID: adminID, Role: RoleAdmin, Token: true, Scopes: Scopes}, ErrScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy(tt.p)
+			switch {
+			case tt.want == nil && err != nil:
+				t.Errorf("denied: %v", err)
+			case tt.want != nil && !errors.Is(err, tt.want):
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			var denial *Denial
+			if err != nil && !errors.As(err, &denial) {
+				t.Errorf("%T is not a *Denial", err)
+			}
+		})
+	}
+}
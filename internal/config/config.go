@@ -0,0 +1,543 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything chirpy can be configured with. Values are layered,
+// each source overriding the one before it:
+//
+//	defaults < config file < .env < environment < command line flags
+//
+// The `env` tag names the environment variable a field is read from.
+type Config struct {
+	Platform string         `yaml:"platform" env:"PLATFORM"`
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Chirps   ChirpsConfig   `yaml:"chirps"`
+	Previews PreviewsConfig `yaml:"previews"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Headers  HeadersConfig  `yaml:"headers"`
+	OIDC     OIDCConfig     `yaml:"oidc"`
+	Mail     MailConfig     `yaml:"mail"`
+}
+
+type ServerConfig struct {
+	ListenAddr     string        `yaml:"listen_addr" env:"LISTEN_ADDR"`
+	ReadTimeout    time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout   time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	MaxHeaderBytes int           `yaml:"max_header_bytes" env:"MAX_HEADER_BYTES"`
+	// DrainDelay is how long the server keeps serving after a shutdown signal
+	// with readiness failing, so load balancers can take it out of rotation.
+	DrainDelay      time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// TrustedProxies are the CIDRs of reverse proxies in front of chirpy.
+	// X-Forwarded-For is only believed from them; empty ignores it.
+	TrustedProxies []string  `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	TLS            TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig turns on HTTPS when both CertFile and KeyFile are set. The files
+// are checked every ReloadInterval and swapped in when they change.
+type TLSConfig struct {
+	CertFile       string        `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile        string        `yaml:"key_file" env:"TLS_KEY_FILE"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL"`
+	// RedirectAddr, when set, is a plain HTTP listener that redirects
+	// everything to HTTPS.
+	RedirectAddr string `yaml:"redirect_addr" env:"TLS_REDIRECT_ADDR"`
+	// HSTSMaxAge is sent in Strict-Transport-Security on HTTPS responses;
+	// zero leaves the header out.
+	HSTSMaxAge time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE"`
+	// H2C serves HTTP/2 without TLS, for deployments behind a proxy that
+	// terminates TLS and speaks HTTP/2 to us. It can't be combined with TLS.
+	H2C bool `yaml:"h2c" env:"H2C"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+type DatabaseConfig struct {
+	URL             string        `yaml:"url" env:"DB_URL"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	PingTimeout     time.Duration `yaml:"ping_timeout" env:"DB_PING_TIMEOUT"`
+	// AutoMigrate applies pending migrations on boot. Replicas starting
+	// together serialize on an advisory lock, so it is safe to enable
+	// everywhere.
+	AutoMigrate bool `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+}
+
+type AuthConfig struct {
+	JWTSigningKey   string        `yaml:"jwt_signing_key" env:"JWT_SIGNING_KEY"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	PolkaKey        string        `yaml:"polka_key" env:"POLKA_KEY"`
+	AdminKey        string        `yaml:"admin_key" env:"ADMIN_API_KEY"`
+	// CookieSessions lets browser clients log in with HttpOnly cookies and
+	// a CSRF token instead of handling tokens themselves.
+	CookieSessions bool           `yaml:"cookie_sessions" env:"AUTH_COOKIE_SESSIONS"`
+	Password       PasswordConfig `yaml:"password"`
+}
+
+// PasswordConfig sets the Argon2id cost for new password hashes and the
+// policy new passwords must meet. Changing the cost doesn't invalidate
+// existing hashes; each is upgraded on the user's next login.
+type PasswordConfig struct {
+	MemoryKiB   int `yaml:"memory_kib" env:"PASSWORD_MEMORY_KIB"`
+	Iterations  int `yaml:"iterations" env:"PASSWORD_ITERATIONS"`
+	Parallelism int `yaml:"parallelism" env:"PASSWORD_PARALLELISM"`
+
+	MinLength      int `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MinEntropyBits int `yaml:"min_entropy_bits" env:"PASSWORD_MIN_ENTROPY_BITS"`
+	// CheckBreached rejects passwords found in BreachedList, or in the list
+	// bundled with chirpy when that is empty. A list is a file of SHA-1
+	// hashes, one per line and sorted, like the Pwned Passwords "ordered by
+	// hash" download. It is searched on disk, so its size doesn't matter.
+	CheckBreached bool   `yaml:"check_breached" env:"PASSWORD_CHECK_BREACHED"`
+	BreachedList  string `yaml:"breached_list" env:"PASSWORD_BREACHED_LIST"`
+}
+
+type ChirpsConfig struct {
+	MaxLength        int           `yaml:"max_length" env:"CHIRP_MAX_LENGTH"`
+	MaxScheduleAhead time.Duration `yaml:"max_schedule_ahead" env:"CHIRP_MAX_SCHEDULE_AHEAD"`
+	ScheduleInterval time.Duration `yaml:"schedule_interval" env:"CHIRP_SCHEDULE_INTERVAL"`
+	PurgeInterval    time.Duration `yaml:"purge_interval" env:"CHIRP_PURGE_INTERVAL"`
+	// RestoreWindow is how long after deletion an author can still restore a
+	// chirp. It must stay shorter than Retention.
+	RestoreWindow time.Duration `yaml:"restore_window" env:"CHIRP_RESTORE_WINDOW"`
+	// Retention is how long soft-deleted chirps and users are kept before the
+	// purge job removes them for good.
+	Retention time.Duration `yaml:"retention" env:"CHIRP_RETENTION"`
+}
+
+type PreviewsConfig struct {
+	CacheTTL     time.Duration `yaml:"cache_ttl" env:"PREVIEW_CACHE_TTL"`
+	FetchTimeout time.Duration `yaml:"fetch_timeout" env:"PREVIEW_FETCH_TIMEOUT"`
+	// AllowPrivate lets previews fetch loopback, link-local and private
+	// addresses, which chirp authors could otherwise use to probe the
+	// internal network. Only for local development.
+	AllowPrivate bool `yaml:"allow_private" env:"PREVIEW_ALLOW_PRIVATE"`
+}
+
+type TracingConfig struct {
+	// Exporter is one of "otlp", "stdout", "memory" or "none".
+	Exporter    string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	ServiceName string `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+}
+
+// MetricsConfig decides where /metrics is served. With ListenAddr set it gets
+// a listener of its own, meant to be reachable only from inside the network;
+// otherwise it is on the public listener and needs admin credentials.
+type MetricsConfig struct {
+	ListenAddr string `yaml:"listen_addr" env:"METRICS_LISTEN_ADDR"`
+}
+
+// MailConfig is where transactional emails go. Without an SMTP address they
+// are written to the log instead.
+type MailConfig struct {
+	SMTPAddr     string `yaml:"smtp_addr" env:"MAIL_SMTP_ADDR"`
+	SMTPUsername string `yaml:"smtp_username" env:"MAIL_SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"MAIL_SMTP_PASSWORD"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+	// LinkBaseURL is the public address of the app, used to build the links
+	// in emails.
+	LinkBaseURL string `yaml:"link_base_url" env:"MAIL_LINK_BASE_URL"`
+}
+
+// CORSConfig lists the browser origins allowed to call the API. List
+// settings are comma separated in the environment.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+type HeadersConfig struct {
+	ContentSecurityPolicy string `yaml:"content_security_policy" env:"CONTENT_SECURITY_POLICY"`
+	FrameOptions          string `yaml:"frame_options" env:"FRAME_OPTIONS"`
+	ReferrerPolicy        string `yaml:"referrer_policy" env:"REFERRER_POLICY"`
+}
+
+// OIDCConfig lists the OpenID Connect providers users can sign in with.
+// Providers only come from the config file; a provider's client secret is
+// better left out of it and set in OIDC_<NAME>_CLIENT_SECRET instead.
+type OIDCConfig struct {
+	Providers map[string]OIDCProviderConfig `yaml:"providers"`
+}
+
+type OIDCProviderConfig struct {
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL must point at /api/auth/<name>/callback and be registered
+	// with the provider.
+	RedirectURL string   `yaml:"redirect_url"`
+	Scopes      []string `yaml:"scopes"`
+}
+
+func Default() Config {
+	return Config{
+		Platform: "prod",
+		Server: ServerConfig{
+			ListenAddr:      ":8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			IdleTimeout:     30 * time.Second,
+			MaxHeaderBytes:  1 << 20, // 1mb
+			DrainDelay:      5 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+			TLS: TLSConfig{
+				ReloadInterval: time.Minute,
+				HSTSMaxAge:     365 * 24 * time.Hour,
+			},
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			PingTimeout:     2 * time.Second,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 60 * 24 * time.Hour,
+			Password: PasswordConfig{
+				MemoryKiB:      64 * 1024,
+				Iterations:     3,
+				Parallelism:    2,
+				MinLength:      8,
+				MinEntropyBits: 35,
+				CheckBreached:  true,
+			},
+		},
+		Chirps: ChirpsConfig{
+			MaxLength:        140,
+			MaxScheduleAhead: 365 * 24 * time.Hour,
+			ScheduleInterval: 15 * time.Second,
+			PurgeInterval:    time.Hour,
+			RestoreWindow:    7 * 24 * time.Hour,
+			Retention:        30 * 24 * time.Hour,
+		},
+		Previews: PreviewsConfig{
+			CacheTTL:     24 * time.Hour,
+			FetchTimeout: 5 * time.Second,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "chirpy",
+		},
+		CORS: CORSConfig{
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID", "X-CSRF-Token"},
+			MaxAge:         10 * time.Minute,
+		},
+		Headers: HeadersConfig{
+			ContentSecurityPolicy: "default-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+			FrameOptions:          "DENY",
+			ReferrerPolicy:        "strict-origin-when-cross-origin",
+		},
+		Mail: MailConfig{
+			LinkBaseURL: "http://localhost:8080",
+		},
+	}
+}
+
+// Flags are the command line overrides every chirpy command accepts.
+type Flags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	platform   *string
+	addr       *string
+	dbURL      *string
+}
+
+// NewFlags registers the config flags on fs, next to whatever flags the
+// command defines itself. Call Load once fs has been parsed.
+func NewFlags(fs *flag.FlagSet) *Flags {
+	return &Flags{
+		fs:         fs,
+		configPath: fs.String("config", os.Getenv("CHIRPY_CONFIG"), "path to a YAML config file"),
+		platform:   fs.String("platform", "", "platform to run as (dev or prod)"),
+		addr:       fs.String("addr", "", "address to listen on"),
+		dbURL:      fs.String("db-url", "", "postgres connection string"),
+	}
+}
+
+// Load parses args as config flags only. args are the command line arguments
+// without the program name.
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	flags := NewFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return flags.Load()
+}
+
+// LoadCLI is Load validating only what the admin commands need; see
+// Flags.LoadCLI.
+func LoadCLI(args []string) (Config, error) {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	flags := NewFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return flags.LoadCLI()
+}
+
+// Load builds the configuration from every source and validates all of it,
+// as serving needs. The config file is taken from -config, falling back to
+// CHIRPY_CONFIG; without either only the other sources are used.
+func (f *Flags) Load() (Config, error) {
+	cfg, err := f.load()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadCLI is Load for the admin commands, which only validates what they use:
+// the platform, the database and password settings, and chirp retention. A
+// migration doesn't need the JWT signing key, for one.
+func (f *Flags) LoadCLI() (Config, error) {
+	cfg, err := f.load()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.ValidateCLI(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (f *Flags) load() (Config, error) {
+	cfg := Default()
+
+	if *f.configPath != "" {
+		if err := loadFile(&cfg, *f.configPath); err != nil {
+			return Config{}, err
+		}
+	}
+
+	// .env never overrides variables that are already set
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("loading .env: %w", err)
+	}
+	if err := loadEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return Config{}, err
+	}
+	for name, provider := range cfg.OIDC.Providers {
+		if secret := os.Getenv("OIDC_" + strings.ToUpper(name) + "_CLIENT_SECRET"); secret != "" {
+			provider.ClientSecret = secret
+			cfg.OIDC.Providers[name] = provider
+		}
+	}
+
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "platform":
+			cfg.Platform = *f.platform
+		case "addr":
+			cfg.Server.ListenAddr = *f.addr
+		case "db-url":
+			cfg.Database.URL = *f.dbURL
+		}
+	})
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+var oidcNamePattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// loadEnv overrides every field with an `env` tag whose variable is set to a
+// non-empty value. String lists are comma separated.
+func loadEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := loadEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := t.Field(i).Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok || raw == "" {
+			continue
+		}
+
+		switch {
+		case field.Type() == durationType:
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetInt(int64(d))
+		case field.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetBool(b)
+		case field.Kind() == reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetInt(int64(n))
+		case field.Kind() == reflect.String:
+			field.SetString(raw)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+			items := []string{}
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		}
+	}
+	return nil
+}
+
+// Validate reports every setting that is missing or out of range.
+func (c Config) Validate() error {
+	return joinErrors(append(c.cliErrors(), c.serveErrors()...))
+}
+
+// ValidateCLI only reports problems with the settings the admin commands
+// use.
+func (c Config) ValidateCLI() error {
+	return joinErrors(c.cliErrors())
+}
+
+func joinErrors(errs []error) error {
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checks collects the failures of a list of check calls.
+type checks []error
+
+func (errs *checks) check(ok bool, format string, args ...any) {
+	if !ok {
+		*errs = append(*errs, fmt.Errorf(format, args...))
+	}
+}
+
+func (c Config) cliErrors() []error {
+	var errs checks
+	check := errs.check
+
+	check(c.Platform == "dev" || c.Platform == "prod", "platform must be dev or prod, got %q", c.Platform)
+	check(c.Database.URL != "", "database.url (DB_URL) is required")
+	// migrations hold an advisory lock on one connection while running on
+	// another
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxOpenConns >= 2, "database.max_open_conns must be 0 (unlimited) or at least 2")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns must not exceed database.max_open_conns")
+	check(c.Database.PingTimeout > 0, "database.ping_timeout must be positive")
+	check(c.Auth.Password.MemoryKiB >= 8*1024 && c.Auth.Password.MemoryKiB <= 4*1024*1024,
+		"auth.password.memory_kib must be between 8192 and 4194304")
+	check(c.Auth.Password.Iterations >= 1 && c.Auth.Password.Iterations <= 100, "auth.password.iterations must be between 1 and 100")
+	check(c.Auth.Password.Parallelism >= 1 && c.Auth.Password.Parallelism <= 255, "auth.password.parallelism must be between 1 and 255")
+	check(c.Auth.Password.MinLength >= 8 && c.Auth.Password.MinLength <= 64, "auth.password.min_length must be between 8 and 64")
+	check(c.Auth.Password.MinEntropyBits >= 0, "auth.password.min_entropy_bits must not be negative")
+	check(c.Auth.Password.BreachedList == "" || c.Auth.Password.CheckBreached,
+		"auth.password.breached_list needs auth.password.check_breached")
+	check(c.Chirps.RestoreWindow > 0, "chirps.restore_window must be positive")
+	check(c.Chirps.Retention > c.Chirps.RestoreWindow, "chirps.retention must be longer than chirps.restore_window")
+	return errs
+}
+
+func (c Config) serveErrors() []error {
+	var errs checks
+	check := errs.check
+
+	check(c.Server.ListenAddr != "", "server.listen_addr is required")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	for _, cidr := range c.Server.TrustedProxies {
+		_, err := netip.ParsePrefix(cidr)
+		check(err == nil, "server.trusted_proxies: %q is not a CIDR like 10.0.0.0/8", cidr)
+	}
+	check(c.Auth.JWTSigningKey != "", "auth.jwt_signing_key (JWT_SIGNING_KEY) is required")
+	check(c.Platform == "dev" || len(c.Auth.JWTSigningKey) >= 32, "auth.jwt_signing_key must be at least 32 bytes outside dev")
+	check(c.Auth.PolkaKey != "", "auth.polka_key (POLKA_KEY) is required")
+	check(c.Platform == "dev" || len(c.Auth.PolkaKey) >= 32, "auth.polka_key must be at least 32 bytes outside dev")
+	check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "auth.refresh_token_ttl must be longer than auth.access_token_ttl")
+	check(c.Chirps.MaxLength > 0, "chirps.max_length must be positive")
+	check(c.Chirps.MaxScheduleAhead > 0, "chirps.max_schedule_ahead must be positive")
+	check(c.Chirps.ScheduleInterval > 0, "chirps.schedule_interval must be positive")
+	check(c.Chirps.PurgeInterval > 0, "chirps.purge_interval must be positive")
+	check(c.Previews.CacheTTL > 0, "previews.cache_ttl must be positive")
+	check(c.Metrics.ListenAddr == "" || c.Metrics.ListenAddr != c.Server.ListenAddr,
+		"metrics.listen_addr must differ from server.listen_addr")
+	check(!c.CORS.AllowCredentials || !slices.Contains(c.CORS.AllowedOrigins, "*"),
+		"cors.allowed_origins can't contain \"*\" when cors.allow_credentials is set")
+	check(c.Headers.FrameOptions == "" || c.Headers.FrameOptions == "DENY" || c.Headers.FrameOptions == "SAMEORIGIN",
+		"headers.frame_options must be DENY or SAMEORIGIN")
+	for name, p := range c.OIDC.Providers {
+		check(oidcNamePattern.MatchString(name), "oidc.providers: name %q must be lowercase letters, digits or -", name)
+		check(p.Issuer != "" && p.ClientID != "" && p.RedirectURL != "",
+			"oidc.providers.%s: issuer, client_id and redirect_url are required", name)
+	}
+	check(c.Mail.SMTPAddr == "" || c.Mail.From != "", "mail.from is required with mail.smtp_addr")
+	if u, err := url.Parse(c.Mail.LinkBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		check(false, "mail.link_base_url must be an absolute http(s) url")
+	}
+	if tls := c.Server.TLS; tls.Enabled() {
+		check(tls.CertFile != "" && tls.KeyFile != "", "server.tls.cert_file and server.tls.key_file must be set together")
+		check(tls.ReloadInterval > 0, "server.tls.reload_interval must be positive")
+		check(!tls.H2C, "server.tls.h2c can't be combined with TLS, which already serves HTTP/2")
+	} else {
+		check(tls.RedirectAddr == "", "server.tls.redirect_addr needs TLS to redirect to")
+	}
+	return errs
+}
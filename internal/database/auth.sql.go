@@ -38,7 +38,11 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 const findRefreshToken = `-- name: FindRefreshToken :one
 SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
 FROM refresh_tokens
-WHERE token = $1
+WHERE token = $1 AND EXISTS (
+    SELECT 1
+    FROM users
+    WHERE users.id = refresh_tokens.user_id AND users.deleted_at IS NULL
+)
 `
 
 func (q *Queries) FindRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
@@ -55,6 +59,60 @@ func (q *Queries) FindRefreshToken(ctx context.Context, token string) (RefreshTo
 	return i, err
 }
 
+const listRefreshTokensForUser = `-- name: ListRefreshTokensForUser :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+FROM refresh_tokens
+WHERE user_id = $1 AND EXISTS (
+    SELECT 1
+    FROM users
+    WHERE users.id = refresh_tokens.user_id AND users.deleted_at IS NULL
+)
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListRefreshTokensForUser(ctx context.Context, userID uuid.NullUUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, listRefreshTokensForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, userID)
+	return err
+}
+
 const updateRefreshToken = `-- name: UpdateRefreshToken :exec
 UPDATE refresh_tokens
 SET
@@ -7,29 +7,105 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const cancelScheduledChirp = `-- name: CancelScheduledChirp :execrows
+UPDATE chirps
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    deleted_by = user_id,
+    deleted_by_role = 'user'
+WHERE id = $1 AND user_id = $2 AND published_at IS NULL AND deleted_at IS NULL
+`
+
+type CancelScheduledChirpParams struct {
+	ID     uuid.UUID
+	UserID uuid.NullUUID
+}
+
+func (q *Queries) CancelScheduledChirp(ctx context.Context, arg CancelScheduledChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelScheduledChirp, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimDueChirps = `-- name: ClaimDueChirps :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
+FROM chirps
+WHERE published_at IS NULL AND publish_at <= $1 AND deleted_at IS NULL
+ORDER BY publish_at ASC
+LIMIT $2
+FOR UPDATE SKIP LOCKED
+`
+
+type ClaimDueChirpsParams struct {
+	PublishAt sql.NullTime
+	Limit     int32
+}
+
+func (q *Queries) ClaimDueChirps(ctx context.Context, arg ClaimDueChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueChirps, arg.PublishAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletedByRole,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at, published_at)
 VALUES (
     gen_random_uuid(),
     CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.NullUUID
+	Body        string
+	UserID      uuid.NullUUID
+	PublishAt   sql.NullTime
+	PublishedAt sql.NullTime
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.PublishAt, arg.PublishedAt)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,24 +113,68 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletedByRole,
 	)
 	return i, err
 }
 
+const deleteAllChirps = `-- name: DeleteAllChirps :exec
+UPDATE chirps
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE deleted_at IS NULL
+`
+
+func (q *Queries) DeleteAllChirps(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteAllChirps)
+	return err
+}
+
 const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps
-WHERE id = $1
+UPDATE chirps
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    deleted_by = $2,
+    deleted_by_role = $3
+WHERE id = $1 AND deleted_at IS NULL
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+type DeleteChirpParams struct {
+	ID            uuid.UUID
+	DeletedBy     uuid.NullUUID
+	DeletedByRole sql.NullString
+}
+
+func (q *Queries) DeleteChirp(ctx context.Context, arg DeleteChirpParams) error {
+	_, err := q.db.ExecContext(ctx, deleteChirp, arg.ID, arg.DeletedBy, arg.DeletedByRole)
+	return err
+}
+
+const deleteChirpsByUser = `-- name: DeleteChirpsByUser :exec
+UPDATE chirps
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    deleted_by = user_id,
+    deleted_by_role = 'user'
+WHERE user_id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) DeleteChirpsByUser(ctx context.Context, userID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirpsByUser, userID)
 	return err
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
 FROM chirps 
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -66,14 +186,85 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletedByRole,
 	)
 	return i, err
 }
 
+const getDeletedChirp = `-- name: GetDeletedChirp :one
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
+FROM chirps
+WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) GetDeletedChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getDeletedChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletedByRole,
+	)
+	return i, err
+}
+
+const listAllChirpsByUser = `-- name: ListAllChirpsByUser :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
+FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListAllChirpsByUser(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listAllChirpsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletedByRole,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listChirps = `-- name: ListChirps :many
-SELECT id, created_at, updated_at, body, user_id 
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role 
 FROM chirps
-ORDER BY created_at DESC
+WHERE published_at IS NOT NULL AND deleted_at IS NULL
+ORDER BY published_at DESC
 `
 
 func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
@@ -91,6 +282,11 @@ func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletedByRole,
 		); err != nil {
 			return nil, err
 		}
@@ -106,10 +302,10 @@ func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const listChirpsByAuthor = `-- name: ListChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
 FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC
+WHERE user_id = $1 AND published_at IS NOT NULL AND deleted_at IS NULL
+ORDER BY published_at ASC
 `
 
 func (q *Queries) ListChirpsByAuthor(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
@@ -127,6 +323,11 @@ func (q *Queries) ListChirpsByAuthor(ctx context.Context, userID uuid.NullUUID)
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletedByRole,
 		); err != nil {
 			return nil, err
 		}
@@ -140,3 +341,113 @@ func (q *Queries) ListChirpsByAuthor(ctx context.Context, userID uuid.NullUUID)
 	}
 	return items, nil
 }
+
+const listScheduledChirps = `-- name: ListScheduledChirps :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
+FROM chirps
+WHERE user_id = $1 AND published_at IS NULL AND deleted_at IS NULL
+ORDER BY publish_at ASC
+`
+
+func (q *Queries) ListScheduledChirps(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduledChirps, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletedByRole,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishChirp = `-- name: PublishChirp :one
+UPDATE chirps
+SET
+    published_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE id = $1 AND published_at IS NULL AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
+`
+
+func (q *Queries) PublishChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, publishChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletedByRole,
+	)
+	return i, err
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET
+    deleted_at = NULL,
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    deleted_by = NULL,
+    deleted_by_role = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published_at, deleted_at, deleted_by, deleted_by_role
+`
+
+func (q *Queries) RestoreChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletedByRole,
+	)
+	return i, err
+}
@@ -11,12 +11,66 @@ import (
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	Action    string
+	Outcome   string
+	ActorID   uuid.NullUUID
+	SubjectID uuid.NullUUID
+	Target    string
+	Ip        string
+	UserAgent string
+	RequestID string
+	Details   string
+}
+
 type Chirp struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Body          string
+	UserID        uuid.NullUUID
+	PublishAt     sql.NullTime
+	PublishedAt   sql.NullTime
+	DeletedAt     sql.NullTime
+	DeletedBy     uuid.NullUUID
+	DeletedByRole sql.NullString
+}
+
+type EmailChange struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
-	UserID    uuid.NullUUID
+	UserID    uuid.UUID
+	NewEmail  string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type LinkPreview struct {
+	Url         string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Description string
+	ImageUrl    string
+	SiteName    string
+	FetchError  sql.NullString
+	FetchedAt   time.Time
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	TokenHint  string
+	Scopes     string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
 }
 
 type RefreshToken struct {
@@ -33,6 +87,23 @@ type User struct {
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 	Email          string
-	HashedPassword string
+	HashedPassword sql.NullString
 	IsChirpyRed    bool
+	DeletedAt      sql.NullTime
+	Handle         string
+	DisplayName    string
+	Bio            string
+	AvatarUrl      string
+	Role           string
+	DisabledAt     sql.NullTime
+}
+
+type UserIdentity struct {
+	Provider    string
+	Subject     string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	Email       string
+	LastLoginAt time.Time
 }
@@ -0,0 +1,18 @@
+package database
+
+import "strings"
+
+// QueryName extracts the sqlc query name from the "-- name: X :kind" header
+// sqlc puts at the top of every generated query, for use in metrics and
+// traces. Queries without the header are reported as "unknown".
+func QueryName(query string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(query, prefix) {
+		return "unknown"
+	}
+	rest := query[len(prefix):]
+	if end := strings.IndexAny(rest, " \n"); end > 0 {
+		return rest[:end]
+	}
+	return "unknown"
+}
@@ -0,0 +1,24 @@
+package database
+
+import "database/sql"
+
+// TxWrapper is implemented by DBTX decorators, like the tracing and metrics
+// ones, that should also apply to queries run inside a transaction.
+type TxWrapper interface {
+	WrapTx(tx *sql.Tx) DBTX
+}
+
+// WrapTx returns tx decorated the same way db is: db's decorators wrap tx
+// when db implements TxWrapper, otherwise tx is returned as is.
+func WrapTx(db DBTX, tx *sql.Tx) DBTX {
+	if w, ok := db.(TxWrapper); ok {
+		return w.WrapTx(tx)
+	}
+	return tx
+}
+
+// InTx is WithTx for instrumented connections. The generated WithTx binds
+// the raw transaction and so skips every decorator; InTx keeps them.
+func (q *Queries) InTx(tx *sql.Tx) *Queries {
+	return New(WrapTx(q.db, tx))
+}
@@ -7,26 +7,36 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url)
 VALUES (
     gen_random_uuid(),
     CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
 )
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, avatar_url
 `
 
 type CreateUserParams struct {
 	Email          string
-	HashedPassword string
+	HashedPassword sql.NullString
+	Handle         string
+	DisplayName    string
+	Bio            string
+	AvatarUrl      string
 }
 
 type CreateUserRow struct {
@@ -35,10 +45,21 @@ type CreateUserRow struct {
 	UpdatedAt   time.Time
 	Email       string
 	IsChirpyRed bool
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+	)
 	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
@@ -46,12 +67,20 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
 	)
 	return i, err
 }
 
 const deleteAllUsers = `-- name: DeleteAllUsers :exec
-DELETE FROM users
+UPDATE users
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE deleted_at IS NULL
 `
 
 func (q *Queries) DeleteAllUsers(ctx context.Context) error {
@@ -59,10 +88,39 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+UPDATE users
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
+const disableUser = `-- name: DisableUser :execrows
+UPDATE users
+SET
+    disabled_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE id = $1 AND deleted_at IS NULL AND disabled_at IS NULL
+`
+
+func (q *Queries) DisableUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, disableUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const findUserByEmail = `-- name: FindUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, deleted_at, handle, display_name, bio, avatar_url, role, disabled_at
 FROM users
-WHERE email = $1
+WHERE email = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) FindUserByEmail(ctx context.Context, email string) (User, error) {
@@ -75,14 +133,21 @@ func (q *Queries) FindUserByEmail(ctx context.Context, email string) (User, erro
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const findUserById = `-- name: FindUserById :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, deleted_at, handle, display_name, bio, avatar_url, role, disabled_at
 FROM users
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) FindUserById(ctx context.Context, id uuid.UUID) (User, error) {
@@ -95,54 +160,273 @@ func (q *Queries) FindUserById(ctx context.Context, id uuid.UUID) (User, error)
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
-const updateUserLogin = `-- name: UpdateUserLogin :one
+const getUserProfile = `-- name: GetUserProfile :one
+SELECT
+    users.id,
+    users.created_at,
+    users.handle,
+    users.display_name,
+    users.bio,
+    users.avatar_url,
+    (
+        SELECT count(*)
+        FROM chirps
+        WHERE chirps.user_id = users.id
+            AND chirps.published_at IS NOT NULL
+            AND chirps.deleted_at IS NULL
+    ) AS chirp_count
+FROM users
+WHERE users.handle = $1 AND users.deleted_at IS NULL
+`
+
+type GetUserProfileRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+	ChirpCount  int64
+}
+
+func (q *Queries) GetUserProfile(ctx context.Context, handle string) (GetUserProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfile, handle)
+	var i GetUserProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.ChirpCount,
+	)
+	return i, err
+}
+
+const listUserSummaries = `-- name: ListUserSummaries :many
+SELECT id, handle, display_name, avatar_url
+FROM users
+WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+`
+
+type ListUserSummariesRow struct {
+	ID          uuid.UUID
+	Handle      string
+	DisplayName string
+	AvatarUrl   string
+}
+
+func (q *Queries) ListUserSummaries(ctx context.Context, dollar_1 []uuid.UUID) ([]ListUserSummariesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserSummaries, pq.Array(dollar_1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserSummariesRow
+	for rows.Next() {
+		var i ListUserSummariesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Handle,
+			&i.DisplayName,
+			&i.AvatarUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = $2
+WHERE id = $1 AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	ID               uuid.UUID
+	HashedPassword   sql.NullString
+	HashedPassword_2 sql.NullString
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.ID, arg.HashedPassword, arg.HashedPassword_2)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users
+SET
+    role = $2,
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users
+SET
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    email = $2
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, avatar_url
+`
+
+type UpdateUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+type UpdateUserEmailRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Email       string
+	IsChirpyRed bool
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (UpdateUserEmailRow, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.ID, arg.Email)
+	var i UpdateUserEmailRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
 UPDATE users
 SET
     updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
-    email = $2,
-    hashed_password = $3
-WHERE id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+    hashed_password = $2
+WHERE id = $1 AND deleted_at IS NULL
 `
 
-type UpdateUserLoginParams struct {
+type UpdateUserPasswordParams struct {
 	ID             uuid.UUID
-	Email          string
-	HashedPassword string
+	HashedPassword sql.NullString
 }
 
-type UpdateUserLoginRow struct {
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    handle = $2,
+    display_name = $3,
+    bio = $4,
+    avatar_url = $5
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, avatar_url
+`
+
+type UpdateUserProfileParams struct {
+	ID          uuid.UUID
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
+}
+
+type UpdateUserProfileRow struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	Email       string
 	IsChirpyRed bool
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarUrl   string
 }
 
-func (q *Queries) UpdateUserLogin(ctx context.Context, arg UpdateUserLoginParams) (UpdateUserLoginRow, error) {
-	row := q.db.QueryRowContext(ctx, updateUserLogin, arg.ID, arg.Email, arg.HashedPassword)
-	var i UpdateUserLoginRow
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (UpdateUserProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile, arg.ID, arg.Handle, arg.DisplayName, arg.Bio, arg.AvatarUrl)
+	var i UpdateUserProfileRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
 	)
 	return i, err
 }
 
-const upgradeUser = `-- name: UpgradeUser :exec
+const upgradeUser = `-- name: UpgradeUser :execrows
 UPDATE users
 SET is_chirpy_red = TRUE
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 `
 
-func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, upgradeUser, id)
-	return err
+func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, upgradeUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
@@ -0,0 +1,206 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat is beaten by a background worker on every pass of its loop. A
+// worker whose heartbeat is older than MaxAge is considered stuck or dead.
+type Heartbeat struct {
+	Name   string
+	MaxAge time.Duration
+	last   atomic.Int64
+}
+
+func NewHeartbeat(name string, maxAge time.Duration) *Heartbeat {
+	return &Heartbeat{Name: name, MaxAge: maxAge}
+}
+
+// Beat records that the worker is alive. It is safe to call on a nil
+// Heartbeat so workers don't need to care whether one is attached.
+func (h *Heartbeat) Beat() {
+	if h == nil {
+		return
+	}
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Last returns when the worker last beat, or the zero time if it never has.
+func (h *Heartbeat) Last() time.Time {
+	n := h.last.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+type Result struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status   string            `json:"status"`
+	Draining bool              `json:"draining"`
+	Checks   map[string]Result `json:"checks"`
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Checker decides whether this instance should receive traffic.
+type Checker struct {
+	db         *sql.DB
+	timeout    time.Duration
+	schema     int64
+	heartbeats []*Heartbeat
+	draining   atomic.Bool
+}
+
+// NewChecker builds a Checker for db. The instance is only ready once the
+// database has applied migrations up to schemaVersion.
+func NewChecker(db *sql.DB, schemaVersion int64, timeout time.Duration) *Checker {
+	return &Checker{
+		db:      db,
+		timeout: timeout,
+		schema:  schemaVersion,
+	}
+}
+
+// Watch adds a worker heartbeat to the readiness checks.
+func (c *Checker) Watch(heartbeats ...*Heartbeat) {
+	c.heartbeats = append(c.heartbeats, heartbeats...)
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending new
+// requests while in-flight ones finish during shutdown.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Check runs every dependency check concurrently.
+func (c *Checker) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"database":   c.checkDB,
+		"migrations": c.checkMigrations,
+	}
+	for _, h := range c.heartbeats {
+		checks["worker:"+h.Name] = func(context.Context) error { return checkHeartbeat(h) }
+	}
+
+	report := Report{
+		Status:   StatusOK,
+		Draining: c.draining.Load(),
+		Checks:   make(map[string]Result, len(checks)),
+	}
+	if report.Draining {
+		report.Status = StatusFail
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			res := Result{Status: StatusOK, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				res.Status = StatusFail
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = res
+			if err != nil {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) checkDB(ctx context.Context) error {
+	if err := c.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("pinging database: %w", err)
+	}
+	return nil
+}
+
+func (c *Checker) checkMigrations(ctx context.Context) error {
+	var have int64
+	err := c.db.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied").Scan(&have)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if have < c.schema {
+		return fmt.Errorf("schema is at version %d, expected %d", have, c.schema)
+	}
+	return nil
+}
+
+func checkHeartbeat(h *Heartbeat) error {
+	last := h.Last()
+	if last.IsZero() {
+		return fmt.Errorf("worker has not started")
+	}
+	if age := time.Since(last); age > h.MaxAge {
+		return fmt.Errorf("last heartbeat %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// Livez reports that the process is up and serving. It never looks at
+// dependencies: a failing database shouldn't get every replica restarted.
+func (c *Checker) Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// Readyz reports whether the instance can take traffic. The body is kept
+// terse since the endpoint is public; Detail has the full report.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("NOT READY"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// Detail serves the full readiness report as JSON.
+func (c *Checker) Detail(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,112 @@
+// Package httpsec has the browser-facing security middlewares: CORS for the
+// API and the response headers that lock down what pages may do.
+package httpsec
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call us, like
+	// "https://app.example.com". "*" allows any origin but can't be combined
+	// with AllowCredentials. Empty turns CORS off.
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+const corsMethods = "GET, POST, PUT, PATCH, DELETE"
+
+// CORS answers preflight requests from allowed origins and adds the
+// Access-Control headers to their actual requests. Requests from other
+// origins are served without them, so browsers refuse to expose the response.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	allowedHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		if len(cfg.AllowedOrigins) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			allowed := origin != "" && (anyOrigin || slices.Contains(cfg.AllowedOrigins, origin))
+			if allowed {
+				if anyOrigin && !cfg.AllowCredentials {
+					h.Set("Access-Control-Allow-Origin", "*")
+				} else {
+					h.Set("Access-Control-Allow-Origin", origin)
+				}
+				if cfg.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if preflight {
+				if allowed {
+					h.Set("Access-Control-Allow-Methods", corsMethods)
+					if allowedHeaders != "" {
+						h.Set("Access-Control-Allow-Headers", allowedHeaders)
+					}
+					if cfg.MaxAge > 0 {
+						h.Set("Access-Control-Max-Age", maxAge)
+					}
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if allowed && exposedHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type HeadersConfig struct {
+	ContentSecurityPolicy string
+	// FrameOptions is DENY or SAMEORIGIN.
+	FrameOptions   string
+	ReferrerPolicy string
+}
+
+// Headers sets the security headers on every response. Empty settings are
+// left out.
+func Headers(cfg HeadersConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			if cfg.ContentSecurityPolicy != "" {
+				h.Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+			}
+			if cfg.FrameOptions != "" {
+				h.Set("X-Frame-Options", cfg.FrameOptions)
+			}
+			if cfg.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Purger hard-deletes soft-deleted chirps and users once they have been in
+// the trash for longer than the retention period. Deleting a user cascades to
+// their remaining chirps and refresh tokens.
+type Purger struct {
+	queries   *database.Queries
+	logger    *zap.SugaredLogger
+	interval  time.Duration
+	retention time.Duration
+	// Heartbeat, when set, is beaten once per pass.
+	Heartbeat *health.Heartbeat
+}
+
+func NewPurger(logger *zap.SugaredLogger, queries *database.Queries, interval, retention time.Duration) *Purger {
+	return &Purger{
+		queries:   queries,
+		logger:    logger,
+		interval:  interval,
+		retention: retention,
+	}
+}
+
+// Run purges expired rows every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Heartbeat.Beat()
+		if _, _, err := p.Purge(ctx); err != nil {
+			p.logger.Errorw("purging deleted rows", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge runs a single purge pass and reports how many rows were removed.
+func (p *Purger) Purge(ctx context.Context) (chirps int64, users int64, err error) {
+	cutoff := sql.NullTime{Time: time.Now().UTC().Add(-p.retention), Valid: true}
+
+	chirps, err = p.queries.PurgeDeletedChirps(ctx, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+	users, err = p.queries.PurgeDeletedUsers(ctx, cutoff)
+	if err != nil {
+		return chirps, 0, err
+	}
+	if chirps > 0 || users > 0 {
+		p.logger.Infow("purged deleted rows", "chirps", chirps, "users", users, "deleted_before", cutoff.Time.Format(time.RFC3339))
+	}
+	return chirps, users, nil
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"chirpy/internal/metrics"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ChirpScheduler publishes chirps whose publish_at has passed. Several
+// replicas can run it at once: due rows are claimed with FOR UPDATE SKIP
+// LOCKED so each chirp is handled by a single replica per round, and a replica
+// that dies mid-batch simply releases its locks for the next one to retry.
+// Each chirp is published under its own savepoint, so a row that fails is
+// logged and skipped instead of holding back the rest of the batch.
+type ChirpScheduler struct {
+	db        *sql.DB
+	queries   *database.Queries
+	logger    *zap.SugaredLogger
+	interval  time.Duration
+	batchSize int32
+	// OnPublish runs for every chirp published in a round, once the round
+	// has been committed.
+	OnPublish func(database.Chirp)
+	// Heartbeat, when set, is beaten once per round.
+	Heartbeat *health.Heartbeat
+}
+
+func NewChirpScheduler(logger *zap.SugaredLogger, db *sql.DB, queries *database.Queries, interval time.Duration) *ChirpScheduler {
+	return &ChirpScheduler{
+		db:        db,
+		queries:   queries,
+		logger:    logger,
+		interval:  interval,
+		batchSize: 100,
+	}
+}
+
+// Run publishes due chirps every interval until ctx is cancelled.
+func (s *ChirpScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Heartbeat.Beat()
+
+		// keep going while full batches get published so a backlog drains
+		// without waiting a whole interval per batch. A batch with failed
+		// rows ends the round, as those rows would only be claimed again.
+		for {
+			published, err := s.publishDue(ctx)
+			if err != nil {
+				s.logger.Errorw("publishing scheduled chirps", "error", err)
+				break
+			}
+			if s.OnPublish != nil {
+				for _, chirp := range published {
+					s.OnPublish(chirp)
+				}
+			}
+			if len(published) < int(s.batchSize) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDue publishes one batch of due chirps and returns the ones that
+// were committed.
+func (s *ChirpScheduler) publishDue(ctx context.Context) ([]database.Chirp, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	q := s.queries.InTx(tx)
+	due, err := q.ClaimDueChirps(ctx, database.ClaimDueChirpsParams{
+		PublishAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		Limit:     s.batchSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claiming due chirps: %w", err)
+	}
+
+	published := make([]database.Chirp, 0, len(due))
+	for _, chirp := range due {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT publish_chirp"); err != nil {
+			return nil, fmt.Errorf("creating savepoint: %w", err)
+		}
+		p, err := q.PublishChirp(ctx, chirp.ID)
+		if err != nil {
+			s.logger.Errorw("publishing scheduled chirp", "chirp_id", chirp.ID, "error", err)
+			metrics.ScheduledChirps.WithLabelValues("failed").Inc()
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT publish_chirp"); err != nil {
+				return nil, fmt.Errorf("rolling back to savepoint: %w", err)
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT publish_chirp"); err != nil {
+			return nil, fmt.Errorf("releasing savepoint: %w", err)
+		}
+		published = append(published, p)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing: %w", err)
+	}
+	metrics.ScheduledChirps.WithLabelValues("published").Add(float64(len(published)))
+	return published, nil
+}
@@ -0,0 +1,163 @@
+// Package lifecycle runs the HTTP servers and background workers of the
+// process and tears them down in order when it is asked to stop.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Manager owns the process lifecycle. On SIGINT or SIGTERM, or when a server
+// fails, it:
+//
+//  1. runs the drain hooks (readiness starts failing) and waits DrainDelay
+//  2. shuts the servers down, letting in-flight requests finish
+//  3. cancels the workers and waits for them to return
+//  4. runs the close hooks in reverse registration order
+//
+// Steps 2 to 4 share a single ShutdownTimeout deadline.
+type Manager struct {
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+
+	logger  *zap.SugaredLogger
+	servers []server
+	workers []worker
+	drains  []func()
+	closers []closer
+}
+
+type server struct {
+	srv    *http.Server
+	listen func() error
+}
+
+type worker struct {
+	name string
+	run  func(context.Context)
+}
+
+type closer struct {
+	name  string
+	close func(context.Context) error
+}
+
+func New(logger *zap.SugaredLogger, drainDelay, shutdownTimeout time.Duration) *Manager {
+	return &Manager{
+		DrainDelay:      drainDelay,
+		ShutdownTimeout: shutdownTimeout,
+		logger:          logger,
+	}
+}
+
+// Serve registers an HTTP server. listen starts it, typically
+// srv.ListenAndServe or srv.ListenAndServeTLS.
+func (m *Manager) Serve(srv *http.Server, listen func() error) {
+	m.servers = append(m.servers, server{srv: srv, listen: listen})
+}
+
+// Go registers a background worker. run must return soon after its context
+// is cancelled.
+func (m *Manager) Go(name string, run func(context.Context)) {
+	m.workers = append(m.workers, worker{name: name, run: run})
+}
+
+// OnDrain registers fn to run as soon as shutdown begins.
+func (m *Manager) OnDrain(fn func()) {
+	m.drains = append(m.drains, fn)
+}
+
+// OnClose registers a resource to release once servers and workers have
+// stopped. Resources are closed in reverse order, so register dependencies
+// (like the database pool) before the things using them.
+func (m *Manager) OnClose(name string, close func(context.Context) error) {
+	m.closers = append(m.closers, closer{name: name, close: close})
+}
+
+// Run starts everything and blocks until ctx is cancelled, a signal arrives
+// or a server fails, then shuts down. The returned error covers the failure
+// that triggered the shutdown, if any, and anything that went wrong during it.
+func (m *Manager) Run(ctx context.Context) error {
+	ctx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	for _, w := range m.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			w.run(workerCtx)
+		}()
+	}
+
+	serveErrs := make(chan error, len(m.servers))
+	for _, s := range m.servers {
+		m.logger.Infow("starting server", "addr", s.srv.Addr)
+		go func() {
+			if err := s.listen(); err != nil && err != http.ErrServerClosed {
+				serveErrs <- fmt.Errorf("serving on %s: %w", s.srv.Addr, err)
+			}
+		}()
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		m.logger.Info("shutdown signal received")
+	case runErr = <-serveErrs:
+		m.logger.Errorw("server failed, shutting down", "error", runErr)
+	}
+	// a second signal kills the process straight away
+	stopSignals()
+
+	for _, fn := range m.drains {
+		fn()
+	}
+	if runErr == nil && m.DrainDelay > 0 {
+		m.logger.Infow("draining", "delay", m.DrainDelay)
+		time.Sleep(m.DrainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.ShutdownTimeout)
+	defer cancel()
+	errs := []error{runErr}
+
+	for _, s := range m.servers {
+		if err := s.srv.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("shutting down server on %s: %w", s.srv.Addr, err))
+		}
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		errs = append(errs, errors.New("background workers did not stop in time"))
+	}
+
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		c := m.closers[i]
+		if err := c.close(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", c.name, err))
+		}
+	}
+
+	m.logger.Info("shutdown complete")
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+// Package mail sends the few transactional emails chirpy needs, like
+// address confirmations. Messages are plain text.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender prints messages instead of sending them, for development and
+// for deployments without a mail server.
+type LogSender struct {
+	Logf func(format string, args ...any)
+}
+
+func (s LogSender) Send(ctx context.Context, msg Message) error {
+	s.Logf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPSender delivers messages through an SMTP relay, authenticating with
+// PLAIN when Username is set. net/smtp upgrades to STARTTLS whenever the
+// server offers it.
+type SMTPSender struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s SMTPSender) Send(ctx context.Context, msg Message) error {
+	// headers are built by hand, so refuse anything that could inject more
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return errors.New("mail: newline in recipient or subject")
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("mail: bad smtp address: %w", err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(b.String())); err != nil {
+		return fmt.Errorf("mail: sending to %s: %w", msg.To, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// InstrumentDB wraps a database.DBTX so every query run through it is timed
+// under the name sqlc gave it.
+func InstrumentDB(db database.DBTX) database.DBTX {
+	return &instrumentedDB{db: db}
+}
+
+type instrumentedDB struct {
+	db database.DBTX
+}
+
+// WrapTx times the queries of a transaction begun on the wrapped database.
+func (i *instrumentedDB) WrapTx(tx *sql.Tx) database.DBTX {
+	return &instrumentedDB{db: database.WrapTx(i.db, tx)}
+}
+
+func (i *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := i.db.ExecContext(ctx, query, args...)
+	observe(query, start, err)
+	return res, err
+}
+
+func (i *instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	start := time.Now()
+	stmt, err := i.db.PrepareContext(ctx, query)
+	observe(query, start, err)
+	return stmt, err
+}
+
+func (i *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	observe(query, start, err)
+	return rows, err
+}
+
+func (i *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+	observe(query, start, row.Err())
+	return row
+}
+
+func observe(query string, start time.Time, err error) {
+	outcome := "ok"
+	if err != nil && err != sql.ErrNoRows {
+		outcome = "error"
+	}
+	DBQueryDuration.WithLabelValues(database.QueryName(query), outcome).Observe(time.Since(start).Seconds())
+}
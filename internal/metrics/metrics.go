@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every chirpy metric. A dedicated registry (rather than the
+// prometheus default one) keeps stray collectors from dependencies out of
+// /metrics.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "chirpy_http_requests_total",
+		Help: "HTTP requests served, by route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chirpy_http_request_duration_seconds",
+		Help:    "Time spent serving HTTP requests, by route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chirpy_db_query_duration_seconds",
+		Help:    "Time spent in database queries, by sqlc query name.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query", "outcome"})
+
+	FileserverHits = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chirpy_fileserver_hits_total",
+		Help: "Requests served from /app/.",
+	})
+
+	ChirpsCreated = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chirpy_chirps_created_total",
+		Help: "Chirps created, including scheduled ones.",
+	})
+
+	Logins = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chirpy_logins_total",
+		Help: "Successful logins.",
+	})
+
+	FailedLogins = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chirpy_failed_logins_total",
+		Help: "Login attempts rejected because of a bad email or password.",
+	})
+
+	ScheduledChirps = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "chirpy_scheduled_chirps_total",
+		Help: "Scheduled chirps handled by the publisher, by outcome.",
+	}, []string{"outcome"})
+
+	WebhooksProcessed = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "chirpy_webhooks_processed_total",
+		Help: "Polka webhooks processed, by event and outcome.",
+	}, []string{"event", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// RegisterDBStats exports the database/sql connection pool stats of db.
+func RegisterDBStats(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records request counts and latencies labelled with the matched
+// route pattern rather than the raw path, so ids in urls don't blow up the
+// label cardinality.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+		HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status = status
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+	return sr.ResponseWriter.Write(b)
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
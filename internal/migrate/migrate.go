@@ -0,0 +1,212 @@
+// Package migrate applies the goose migrations embedded in the binary. It runs
+// them through goose itself, so every goose annotation (StatementBegin/End,
+// NO TRANSACTION, ...) behaves as documented and the goose CLI keeps working
+// against the same database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pressly/goose/v3"
+)
+
+// lockKey is the postgres advisory lock held while migrating, so replicas
+// booting at the same time apply each migration once.
+const lockKey = 0x63686972 // "chir"
+
+var ErrNoMigration = errors.New("no migration to roll back")
+
+type Migration struct {
+	Version int64
+	Name    string
+}
+
+type Status struct {
+	Migration
+	AppliedAt time.Time
+	Applied   bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	// Logf, when set, is told about every migration that gets applied or
+	// rolled back.
+	Logf func(format string, args ...any)
+}
+
+// New loads the .sql migrations in the root of fsys. goose keeps its
+// filesystem and dialect in package state, so every Migrator shares them.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	goose.SetBaseFS(fsys)
+	if err := goose.SetDialect("postgres"); err != nil {
+		return nil, err
+	}
+	collected, err := goose.CollectMigrations(".", 0, goose.MaxVersion)
+	if err != nil {
+		return nil, fmt.Errorf("listing migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(collected))
+	for _, m := range collected {
+		migrations = append(migrations, Migration{Version: m.Version, Name: path.Base(m.Source)})
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest is the version the schema ends up at once every migration is
+// applied.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration, oldest first.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		return goose.Up(m.db, ".")
+	})
+}
+
+// UpTo applies the pending migrations up to and including version.
+func (m *Migrator) UpTo(ctx context.Context, version int64) error {
+	return m.locked(ctx, func() error {
+		return goose.UpTo(m.db, ".", version)
+	})
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		if err := m.requireApplied(); err != nil {
+			return err
+		}
+		return goose.Down(m.db, ".")
+	})
+}
+
+// Redo rolls back the most recently applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.locked(ctx, func() error {
+		if err := m.requireApplied(); err != nil {
+			return err
+		}
+		return goose.Redo(m.db, ".")
+	})
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if _, err := goose.EnsureDBVersion(m.db); err != nil {
+		return nil, fmt.Errorf("creating version table: %w", err)
+	}
+	applied, err := appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) requireApplied() error {
+	version, err := goose.GetDBVersion(m.db)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version == 0 {
+		return ErrNoMigration
+	}
+	return nil
+}
+
+// locked runs fn while holding the migration advisory lock. Session level
+// locks belong to a connection, so the lock sits on a dedicated sql.Conn
+// while goose works through the rest of the pool; the pool needs room for
+// at least two connections.
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("getting connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	goose.SetLogger(gooseLogger{logf: m.Logf})
+	return fn()
+}
+
+// appliedVersions maps every applied version to when it was applied. Like
+// goose, the newest row for a version decides its state.
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int64]time.Time, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT version_id, is_applied, tstamp FROM goose_db_version ORDER BY id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("reading version table: %w", err)
+	}
+	defer rows.Close()
+
+	seen := map[int64]bool{}
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var tstamp sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, fmt.Errorf("reading version table: %w", err)
+		}
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+		if isApplied && version != 0 {
+			applied[version] = tstamp.Time
+		}
+	}
+	return applied, rows.Err()
+}
+
+// gooseLogger hands goose's progress lines to Logf. goose only calls Fatal
+// from its CLI, never from the library functions used here.
+type gooseLogger struct {
+	logf func(format string, args ...any)
+}
+
+func (l gooseLogger) Printf(format string, v ...any) {
+	if l.logf != nil {
+		l.logf(strings.TrimSuffix(format, "\n"), v...)
+	}
+}
+
+func (l gooseLogger) Print(v ...any) {
+	l.Printf("%s", fmt.Sprint(v...))
+}
+
+func (l gooseLogger) Println(v ...any) {
+	l.Printf("%s", strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+func (l gooseLogger) Fatal(v ...any) {
+	panic(fmt.Sprint(v...))
+}
+
+func (l gooseLogger) Fatalf(format string, v ...any) {
+	panic(fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"chirpy/internal/dbtest"
+	"chirpy/sql/schema"
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+)
+
+func TestNewLoadsEveryMigration(t *testing.T) {
+	m, err := New(nil, schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := fs.Glob(schema.FS, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.migrations) != len(files) {
+		t.Fatalf("loaded %d migrations, want %d", len(m.migrations), len(files))
+	}
+	for i := 1; i < len(m.migrations); i++ {
+		if m.migrations[i].Version <= m.migrations[i-1].Version {
+			t.Errorf("%s is not ordered after %s", m.migrations[i].Name, m.migrations[i-1].Name)
+		}
+	}
+	if last := m.migrations[len(m.migrations)-1]; m.Latest() != last.Version {
+		t.Errorf("Latest() = %d, want %d", m.Latest(), last.Version)
+	}
+}
+
+// TestMigrationsUpDownUp applies every migration, rolls it back and applies it
+// again, so each Down section is exercised against the schema it undoes.
+func TestMigrationsUpDownUp(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+
+	m, err := New(db, schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Logf = t.Logf
+
+	if err := m.Down(ctx); !errors.Is(err, ErrNoMigration) {
+		t.Fatalf("down on an empty database: got %v, want ErrNoMigration", err)
+	}
+
+	assertVersion := func(t *testing.T, want int64) {
+		t.Helper()
+		got, err := goose.GetDBVersion(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("schema version = %d, want %d", got, want)
+		}
+	}
+
+	previous := int64(0)
+	for _, migration := range m.migrations {
+		t.Run(migration.Name, func(t *testing.T) {
+			if err := m.UpTo(ctx, migration.Version); err != nil {
+				t.Fatalf("up: %v", err)
+			}
+			assertVersion(t, migration.Version)
+			if err := m.Down(ctx); err != nil {
+				t.Fatalf("down: %v", err)
+			}
+			assertVersion(t, previous)
+			if err := m.UpTo(ctx, migration.Version); err != nil {
+				t.Fatalf("up again: %v", err)
+			}
+			assertVersion(t, migration.Version)
+		})
+		previous = migration.Version
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("%s is not applied", s.Name)
+		}
+	}
+
+	// and the whole chain down and back up, the way a fresh deploy and a
+	// full rollback would run it
+	for range m.migrations {
+		if err := m.Down(ctx); err != nil {
+			t.Fatalf("down: %v", err)
+		}
+	}
+	assertVersion(t, 0)
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	assertVersion(t, m.Latest())
+
+	var tables int
+	err = db.QueryRowContext(ctx, `SELECT count(*) FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = ANY($1)`,
+		"{"+strings.Join([]string{"users", "chirps", "audit_events"}, ",")+"}").Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables != 3 {
+		t.Errorf("found %d of the users, chirps and audit_events tables, want 3", tables)
+	}
+}
@@ -0,0 +1,413 @@
+// Package oidc is a small OpenID Connect relying party: provider discovery,
+// the authorization code flow with PKCE, and ID token verification against
+// the provider's JWKS. Only RS256 signed ID tokens are accepted, which every
+// mainstream provider issues.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// clockSkew is how far the provider's clock may be off from ours.
+const clockSkew = time.Minute
+
+// jwksMinRefresh limits how often an unknown key id makes us refetch the
+// JWKS, so junk tokens can't make us hammer the provider.
+const jwksMinRefresh = time.Minute
+
+type Config struct {
+	// Name identifies the provider in URLs and in user_identities.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes default to openid, email and profile.
+	Scopes     []string
+	HTTPClient *http.Client
+}
+
+type Provider struct {
+	cfg Config
+
+	mu          sync.Mutex
+	discovered  *discovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider doesn't contact the provider: discovery happens on first use
+// so an unreachable provider doesn't stop the server from booting.
+func NewProvider(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if !slices.Contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// Claims are the ID token claims chirpy uses.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// Valid checks the time based claims; Verify checks the rest.
+func (c *Claims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return errors.New("id token has expired")
+	}
+	if c.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("id token issued in the future")
+	}
+	return nil
+}
+
+// audience is a single string or a list of strings in a JWT.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// AuthCodeURL is where to send the browser to sign in. state and nonce tie
+// the callback and the ID token to this attempt; verifier is the PKCE code
+// verifier, sent as its S256 challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades an authorization code for the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("exchanging code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("decoding token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return token.IDToken, nil
+}
+
+// Verify checks the ID token's signature, issuer, audience, lifetime and
+// nonce, and returns its claims.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}}
+	_, err = parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w", err)
+	}
+
+	if claims.Issuer != d.Issuer {
+		return nil, fmt.Errorf("id token issued by %q, expected %q", claims.Issuer, d.Issuer)
+	}
+	if !slices.Contains(claims.Audience, p.cfg.ClientID) {
+		return nil, errors.New("id token is not meant for this client")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+	return claims, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered != nil {
+		return p.discovered, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	d := &discovery{}
+	if err := p.getJSON(ctx, wellKnown, d); err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.cfg.Name, err)
+	}
+	// the issuer must match exactly, or tokens from another tenant of the
+	// same provider would verify
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovering %s: issuer is %q, expected %q", p.cfg.Name, d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: incomplete provider metadata", p.cfg.Name)
+	}
+	p.discovered = d
+	return d, nil
+}
+
+// key returns the provider's signing key with the given id, refetching the
+// JWKS when the key is unknown, as providers rotate keys.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.discovered.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	p.keysFetched = time.Now()
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds kid in the cached keys. Tokens without a kid are allowed
+// when the provider only has one key.
+func (p *Provider) lookupKey(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(dst)
+}
+
+// RandomString returns a URL safe random string, used for state, nonce and
+// the PKCE verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Flow is one sign-in attempt. It lives in a signed cookie between the
+// redirect to the provider and the callback, so no server side state is
+// needed.
+type Flow struct {
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+type flowClaims struct {
+	jwt.StandardClaims
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// flowIssuer keeps sealed flows from being mistaken for access tokens,
+// which are signed with the same secret: ValidateJWT in package auth only
+// accepts its own issuer, and OpenFlow only this one.
+const flowIssuer = "chirpy-oidc-flow"
+
+func NewFlow(provider string) (Flow, error) {
+	f := Flow{Provider: provider}
+	for _, s := range []*string{&f.State, &f.Nonce, &f.Verifier} {
+		var err error
+		if *s, err = RandomString(); err != nil {
+			return Flow{}, err
+		}
+	}
+	return f, nil
+}
+
+// Seal signs the flow so it can be handed to the browser.
+func (f Flow) Seal(secret string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, flowClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    flowIssuer,
+			Audience:  f.Provider,
+			Id:        f.State,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+		Nonce:    f.Nonce,
+		Verifier: f.Verifier,
+	}).SignedString([]byte(secret))
+}
+
+// OpenFlow checks a sealed flow's signature and expiry.
+func OpenFlow(sealed, secret string) (Flow, error) {
+	claims := &flowClaims{}
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}}
+	_, err := parser.ParseWithClaims(sealed, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return Flow{}, fmt.Errorf("parsing sign-in state: %w", err)
+	}
+	if claims.Issuer != flowIssuer {
+		return Flow{}, errors.New("not a sign-in state")
+	}
+	return Flow{
+		Provider: claims.Audience,
+		State:    claims.Id,
+		Nonce:    claims.Nonce,
+		Verifier: claims.Verifier,
+	}, nil
+}
@@ -0,0 +1,285 @@
+package preview
+
+import (
+	"chirpy/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var ErrBlockedAddress = errors.New("destination address is not allowed")
+
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+type FetcherConfig struct {
+	Timeout      time.Duration
+	MaxBodyBytes int64
+	MaxRedirects int
+	UserAgent    string
+	// AllowPrivate disables the private network checks. Only meant for local
+	// development and tests against an httptest server.
+	AllowPrivate bool
+}
+
+type Fetcher struct {
+	FetcherConfig
+	client *http.Client
+}
+
+func NewFetcher(cfg FetcherConfig) *Fetcher {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxBodyBytes == 0 {
+		cfg.MaxBodyBytes = 512 << 10 // 512kb
+	}
+	if cfg.MaxRedirects == 0 {
+		cfg.MaxRedirects = 3
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "ChirpyBot/1.0 (+link preview)"
+	}
+
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+	}
+	if !cfg.AllowPrivate {
+		// checking in Control means we validate the address actually being
+		// connected to, after DNS resolution, so rebinding tricks don't work
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("parsing dial address: %w", err)
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	f := &Fetcher{FetcherConfig: cfg}
+	f.client = &http.Client{
+		Transport: tracing.Transport(transport),
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+			}
+			return checkScheme(req.URL)
+		},
+	}
+	return f
+}
+
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Preview{}, fmt.Errorf("parsing url: %w", err)
+	}
+	if err := checkScheme(u); err != nil {
+		return Preview{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Preview{}, fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("User-Agent", f.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, fmt.Errorf("fetching %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return Preview{}, fmt.Errorf("unsupported content type: %q", mediaType)
+	}
+
+	p, err := parse(io.LimitReader(resp.Body, f.MaxBodyBytes))
+	if err != nil {
+		return Preview{}, fmt.Errorf("parsing html: %w", err)
+	}
+	p.URL = rawURL
+	// relative og:image values are resolved against the final (post-redirect) url
+	if p.ImageURL != "" {
+		if img, err := resp.Request.URL.Parse(p.ImageURL); err == nil {
+			p.ImageURL = img.String()
+		}
+	}
+	return p, nil
+}
+
+// parse pulls OpenGraph and Twitter card metadata out of the document head,
+// falling back to <title> and the description meta tag.
+func parse(r io.Reader) (Preview, error) {
+	var p Preview
+	var fallbackTitle, fallbackDesc, twitterTitle, twitterDesc, twitterImage string
+
+	z := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF && err != io.ErrUnexpectedEOF {
+				return Preview{}, err
+			}
+			return finish(p, fallbackTitle, fallbackDesc, twitterTitle, twitterDesc, twitterImage), nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = tt == html.StartTagToken
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				key, content := metaAttrs(z)
+				switch key {
+				case "og:title":
+					p.Title = content
+				case "og:description":
+					p.Description = content
+				case "og:image", "og:image:url":
+					if p.ImageURL == "" {
+						p.ImageURL = content
+					}
+				case "og:site_name":
+					p.SiteName = content
+				case "twitter:title":
+					twitterTitle = content
+				case "twitter:description":
+					twitterDesc = content
+				case "twitter:image", "twitter:image:src":
+					twitterImage = content
+				case "description":
+					fallbackDesc = content
+				}
+			}
+		case html.TextToken:
+			if inTitle && fallbackTitle == "" {
+				fallbackTitle = strings.TrimSpace(string(z.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				// everything we care about lives in <head>
+				return finish(p, fallbackTitle, fallbackDesc, twitterTitle, twitterDesc, twitterImage), nil
+			}
+		}
+	}
+}
+
+func finish(p Preview, title, desc, twTitle, twDesc, twImage string) Preview {
+	if p.Title == "" {
+		p.Title = firstNonEmpty(twTitle, title)
+	}
+	if p.Description == "" {
+		p.Description = firstNonEmpty(twDesc, desc)
+	}
+	if p.ImageURL == "" {
+		p.ImageURL = twImage
+	}
+	return p
+}
+
+func metaAttrs(z *html.Tokenizer) (key string, content string) {
+	for {
+		k, v, more := z.TagAttr()
+		switch strings.ToLower(string(k)) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(v)))
+			}
+		case "content":
+			content = strings.TrimSpace(string(v))
+		}
+		if !more {
+			return key, content
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("url is missing a host")
+	}
+	return nil
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	switch {
+	case !addr.IsValid(),
+		addr.IsUnspecified(),
+		addr.IsLoopback(),
+		addr.IsPrivate(),
+		addr.IsLinkLocalUnicast(),
+		addr.IsLinkLocalMulticast(),
+		addr.IsInterfaceLocalMulticast(),
+		addr.IsMulticast(),
+		sharedAddressSpace.Contains(addr):
+		return false
+	}
+	return true
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// FirstURL returns the first http(s) URL found in a chirp body, or "" when
+// there is none. Trailing punctuation is trimmed so "see https://x.com." works.
+func FirstURL(body string) string {
+	match := urlPattern.FindString(body)
+	return strings.TrimRight(match, ".,;:!?)]}'")
+}
@@ -0,0 +1,179 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const page = `<html><head>
+<title>Fallback</title>
+<meta property="og:title" content="Hello">
+<meta property="og:image" content="/img.png">
+</head><body></body></html>`
+
+func serveHTML(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(serveHTML(page))
+	defer srv.Close()
+
+	f := NewFetcher(FetcherConfig{Timeout: time.Second})
+	_, err := f.Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("fetching %s: got %v, want ErrBlockedAddress", srv.URL, err)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestFetchRedirectCap(t *testing.T) {
+	var hits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hop/{n}", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		var n int
+		fmt.Sscan(r.PathValue("n"), &n)
+		if n == 0 {
+			serveHTML(page)(w, r)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		hops    int
+		wantErr bool
+	}{
+		{hops: 0},
+		{hops: 2},
+		{hops: 3, wantErr: true},
+		{hops: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d hops", tt.hops), func(t *testing.T) {
+			hits.Store(0)
+			f := NewFetcher(FetcherConfig{Timeout: time.Second, MaxRedirects: 2, AllowPrivate: true})
+			p, err := f.Fetch(context.Background(), fmt.Sprintf("%s/hop/%d", srv.URL, tt.hops))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "stopped after 2 redirects") {
+					t.Fatalf("got %v, want redirect cap error", err)
+				}
+				if hits.Load() != 3 {
+					t.Errorf("server saw %d requests, want 3", hits.Load())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Title != "Hello" {
+				t.Errorf("title = %q, want Hello", p.Title)
+			}
+			// relative images resolve against the final url
+			if want := srv.URL + "/img.png"; p.ImageURL != want {
+				t.Errorf("image = %q, want %q", p.ImageURL, want)
+			}
+		})
+	}
+}
+
+func TestFetchBodySizeCap(t *testing.T) {
+	padded := "<html><head><title>Fallback</title>" + strings.Repeat("<!-- padding -->", 1024) +
+		`<meta property="og:title" content="Too late"></head></html>`
+	srv := httptest.NewServer(serveHTML(padded))
+	defer srv.Close()
+
+	tests := []struct {
+		maxBody int64
+		want    string
+	}{
+		{maxBody: 1 << 20, want: "Too late"},
+		{maxBody: 1024, want: "Fallback"},
+	}
+	for _, tt := range tests {
+		f := NewFetcher(FetcherConfig{Timeout: time.Second, MaxBodyBytes: tt.maxBody, AllowPrivate: true})
+		p, err := f.Fetch(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatalf("max body %d: %v", tt.maxBody, err)
+		}
+		if p.Title != tt.want {
+			t.Errorf("max body %d: title = %q, want %q", tt.maxBody, p.Title, tt.want)
+		}
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	f := NewFetcher(FetcherConfig{Timeout: 100 * time.Millisecond, AllowPrivate: true})
+	start := time.Now()
+	_, err := f.Fetch(context.Background(), srv.URL)
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetch took %s, want it cut off near the 100ms timeout", elapsed)
+	}
+}
+
+func TestFetchRejectsNonHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+
+	f := NewFetcher(FetcherConfig{Timeout: time.Second, AllowPrivate: true})
+	if _, err := f.Fetch(context.Background(), srv.URL); err == nil {
+		t.Fatal("expected an unsupported content type error")
+	}
+	if _, err := f.Fetch(context.Background(), "ftp://example.com/file"); err == nil {
+		t.Fatal("expected an unsupported scheme error")
+	}
+}
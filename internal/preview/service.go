@@ -0,0 +1,102 @@
+package preview
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Service unfurls links in the background so chirp creation never waits on a
+// third party website. Results, including failures, are cached in the
+// link_previews table and refreshed once they are older than CacheTTL.
+type Service struct {
+	fetcher  *Fetcher
+	db       *database.Queries
+	queue    chan string
+	cacheTTL time.Duration
+	logger   *zap.SugaredLogger
+	// Heartbeat, when set, is beaten after every url and at least once per
+	// HeartbeatInterval while the queue is idle.
+	Heartbeat *health.Heartbeat
+}
+
+const HeartbeatInterval = 30 * time.Second
+
+func NewService(logger *zap.SugaredLogger, fetcher *Fetcher, db *database.Queries, cacheTTL time.Duration) *Service {
+	return &Service{
+		fetcher:  fetcher,
+		db:       db,
+		queue:    make(chan string, 100),
+		cacheTTL: cacheTTL,
+		logger:   logger,
+	}
+}
+
+// Enqueue schedules a fetch for rawURL. It never blocks; when the queue is
+// full the url is dropped and will be picked up the next time it is posted.
+func (s *Service) Enqueue(rawURL string) {
+	if rawURL == "" {
+		return
+	}
+	select {
+	case s.queue <- rawURL:
+	default:
+		s.logger.Warnw("link preview queue full, dropping url", "url", rawURL)
+	}
+}
+
+// Run processes queued urls until ctx is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		s.Heartbeat.Beat()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case rawURL := <-s.queue:
+			s.process(ctx, rawURL)
+		}
+	}
+}
+
+func (s *Service) process(ctx context.Context, rawURL string) {
+	cached, err := s.db.GetLinkPreview(ctx, rawURL)
+	if err == nil && time.Since(cached.FetchedAt) < s.cacheTTL {
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		s.logger.Errorw("looking up cached link preview", "url", rawURL, "error", err)
+		return
+	}
+
+	params := database.UpsertLinkPreviewParams{Url: rawURL}
+	p, err := s.fetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		s.logger.Infow("fetching link preview", "url", rawURL, "error", err)
+		params.FetchError = sql.NullString{String: err.Error(), Valid: true}
+	} else {
+		params.Title = truncate(p.Title, 300)
+		params.Description = truncate(p.Description, 1000)
+		params.ImageUrl = truncate(p.ImageURL, 2048)
+		params.SiteName = truncate(p.SiteName, 200)
+	}
+
+	if err := s.db.UpsertLinkPreview(ctx, params); err != nil {
+		s.logger.Errorw("storing link preview", "url", rawURL, "error", err)
+	}
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max])
+}
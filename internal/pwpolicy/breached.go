@@ -0,0 +1,201 @@
+package pwpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// breached.txt holds the uppercase SHA-1 of well known breached and
+// default passwords, one per line. Only hashes are shipped; extend it by
+// appending the hashes of more passwords.
+//
+//go:embed breached.txt
+var bundled string
+
+var bundledRanges = sync.OnceValue(func() *LocalRanges {
+	ranges, err := NewLocalRanges(strings.NewReader(bundled))
+	if err != nil {
+		panic(fmt.Sprintf("pwpolicy: bundled breached list: %v", err))
+	}
+	return ranges
+})
+
+// Bundled returns the breached-password list built into chirpy.
+func Bundled() *LocalRanges {
+	return bundledRanges()
+}
+
+// LocalRanges serves range queries from an in-memory list.
+type LocalRanges struct {
+	ranges map[string][]string
+}
+
+// NewLocalRanges reads SHA-1 hashes, one per line. Lines may carry a
+// ":count" suffix as in the Pwned Passwords downloads; it's ignored.
+func NewLocalRanges(r io.Reader) (*LocalRanges, error) {
+	ranges := map[string][]string{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+		if len(hash) != 40 || strings.Trim(strings.ToUpper(hash), "0123456789ABCDEF") != "" {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		hash = strings.ToUpper(hash)
+		ranges[hash[:5]] = append(ranges[hash[:5]], hash[5:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &LocalRanges{ranges: ranges}, nil
+}
+
+func (l *LocalRanges) Range(ctx context.Context, prefix string) ([]string, error) {
+	return l.ranges[strings.ToUpper(prefix)], nil
+}
+
+// maxLineLength bounds a line of a sorted list: 40 hex digits, a count and
+// a line ending fit easily.
+const maxLineLength = 128
+
+// SortedFile serves range queries from a file of hashes in NewLocalRanges'
+// format sorted by hash, like the Pwned Passwords "ordered by hash"
+// download. That list is tens of gigabytes, so nothing is loaded up front:
+// each query binary searches the file for its prefix.
+type SortedFile struct {
+	path string
+}
+
+// OpenSortedFile checks that path is readable and starts with a hash. The
+// sort order can't be checked without reading the whole file; an unsorted
+// file makes lookups miss.
+func OpenSortedFile(path string) (*SortedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	line, err := readLine(f, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := parseLine(line); err != nil {
+		return nil, fmt.Errorf("%s: line 1: %w", path, err)
+	}
+	return &SortedFile{path: path}, nil
+}
+
+func (s *SortedFile) Range(ctx context.Context, prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// find the first line at or after some offset whose hash isn't below
+	// the prefix; lines only move forward as the offset does, so the
+	// smallest such offset is found by bisection
+	var searchErr error
+	start := sort.Search(int(info.Size()), func(off int) bool {
+		line, err := lineFrom(f, int64(off))
+		if err != nil {
+			if err != io.EOF {
+				searchErr = err
+			}
+			return true
+		}
+		return line.hash[:5] >= prefix
+	})
+	if searchErr != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, searchErr)
+	}
+
+	suffixes := []string{}
+	for off := lineStart(f, int64(start)); ; {
+		raw, err := readLine(f, off)
+		if err == io.EOF && raw == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", s.path, err)
+		}
+		line, err := parseLine(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.path, err)
+		}
+		if line.hash[:5] != prefix {
+			break
+		}
+		suffixes = append(suffixes, line.hash[5:])
+		off += int64(len(raw)) + 1
+	}
+	return suffixes, nil
+}
+
+type sortedLine struct {
+	hash string
+}
+
+func parseLine(raw string) (sortedLine, error) {
+	hash, _, _ := strings.Cut(strings.TrimSpace(raw), ":")
+	if len(hash) != 40 || strings.Trim(strings.ToUpper(hash), "0123456789ABCDEF") != "" {
+		return sortedLine{}, errors.New("not a SHA-1 hash")
+	}
+	return sortedLine{hash: strings.ToUpper(hash)}, nil
+}
+
+// lineFrom parses the first line starting at or after off.
+func lineFrom(f io.ReaderAt, off int64) (sortedLine, error) {
+	raw, err := readLine(f, lineStart(f, off))
+	if raw == "" {
+		if err == nil {
+			err = io.EOF
+		}
+		return sortedLine{}, err
+	}
+	if err != nil && err != io.EOF {
+		return sortedLine{}, err
+	}
+	return parseLine(raw)
+}
+
+// lineStart returns off when a line starts there, or else where the next
+// line starts.
+func lineStart(f io.ReaderAt, off int64) int64 {
+	if off == 0 {
+		return 0
+	}
+	raw, _ := readLine(f, off-1)
+	return off + int64(len(raw))
+}
+
+// readLine returns the line starting at off, without its newline, and
+// io.EOF if the file ends before a newline.
+func readLine(f io.ReaderAt, off int64) (string, error) {
+	buf := make([]byte, maxLineLength)
+	n, err := f.ReadAt(buf, off)
+	if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+		return string(buf[:i]), nil
+	}
+	if err == nil {
+		return "", errors.New("line too long")
+	}
+	return string(buf[:n]), err
+}
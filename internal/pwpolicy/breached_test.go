@@ -0,0 +1,117 @@
+package pwpolicy
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeSorted writes hashes sorted, in the Pwned Passwords format, and
+// returns the file's path. trailing ends the last line too.
+func writeSorted(t *testing.T, hashes []string, ending string, trailing bool) string {
+	t.Helper()
+	sorted := slices.Clone(hashes)
+	sort.Strings(sorted)
+	var b strings.Builder
+	for i, hash := range sorted {
+		fmt.Fprintf(&b, "%s:%d", hash, i+1)
+		if i < len(sorted)-1 || trailing {
+			b.WriteString(ending)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testHashes(n int) []string {
+	hashes := []string{}
+	for i := 0; i < n; i++ {
+		sum := sha1.Sum([]byte(fmt.Sprint(i)))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+		// a few neighbours sharing the prefix
+		if i%50 == 0 {
+			hashes = append(hashes, hashes[len(hashes)-1][:5]+strings.Repeat("0", 35))
+		}
+	}
+	return hashes
+}
+
+func TestSortedFileMatchesLocalRanges(t *testing.T) {
+	hashes := testHashes(2000)
+	local, err := NewLocalRanges(strings.NewReader(strings.Join(hashes, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefixes := []string{"00000", "FFFFF", "12345"}
+	for _, hash := range hashes {
+		prefixes = append(prefixes, hash[:5])
+	}
+	slices.Sort(prefixes)
+	first, last := prefixes[0], prefixes[len(prefixes)-1]
+	prefixes = append(prefixes, strings.ToLower(first), last)
+
+	for _, tt := range []struct {
+		ending   string
+		trailing bool
+	}{{"\n", true}, {"\r\n", true}, {"\n", false}} {
+		t.Run(fmt.Sprintf("ending %q trailing %v", tt.ending, tt.trailing), func(t *testing.T) {
+			file, err := OpenSortedFile(writeSorted(t, hashes, tt.ending, tt.trailing))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, prefix := range prefixes {
+				want, _ := local.Range(context.Background(), prefix)
+				got, err := file.Range(context.Background(), prefix)
+				if err != nil {
+					t.Fatalf("range %s: %v", prefix, err)
+				}
+				slices.Sort(want)
+				if !slices.Equal(got, want) && !(len(got) == 0 && len(want) == 0) {
+					t.Fatalf("range %s = %v, want %v", prefix, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSortedFileIsBreached(t *testing.T) {
+	sum := sha1.Sum([]byte("password123"))
+	breached := strings.ToUpper(hex.EncodeToString(sum[:]))
+	file, err := OpenSortedFile(writeSorted(t, append(testHashes(100), breached), "\n", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for password, want := range map[string]bool{"password123": true, "correct horse battery staple": false} {
+		got, err := IsBreached(context.Background(), file, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("IsBreached(%q) = %v, want %v", password, got, want)
+		}
+	}
+}
+
+func TestOpenSortedFileRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSortedFile(path); err == nil {
+		t.Error("expected an error for a file that isn't a hash list")
+	}
+	if _, err := OpenSortedFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
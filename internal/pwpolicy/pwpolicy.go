@@ -0,0 +1,169 @@
+// Package pwpolicy decides whether a new password is good enough to accept.
+// It rejects passwords that are too short or too predictable, that contain
+// the user's own details, or that appear in a list of breached passwords.
+package pwpolicy
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation codes. Like API error codes they are part of the contract.
+const (
+	CodeTooShort       = "too_short"
+	CodeTooLong        = "too_long"
+	CodeTooPredictable = "too_predictable"
+	CodePersonalInfo   = "contains_personal_info"
+	CodeBreached       = "breached"
+)
+
+// Violation is one reason a password was refused. Message is safe to show
+// the user.
+type Violation struct {
+	Code    string
+	Message string
+}
+
+// Policy checks passwords. The zero value accepts anything.
+type Policy struct {
+	MinLength int
+	// MaxLength keeps hashing cost bounded.
+	MaxLength int
+	// MinEntropy is the minimum estimated strength, in bits.
+	MinEntropy float64
+	// Breached, when set, is consulted for known breached passwords.
+	Breached Ranges
+}
+
+// Check returns every rule password breaks, or none if it is acceptable.
+// personal are details like the user's email, which the password must not
+// contain. An error means the breached-password source couldn't be reached.
+func (p Policy) Check(ctx context.Context, password string, personal ...string) ([]Violation, error) {
+	violations := []Violation{}
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, Violation{CodeTooShort,
+			fmt.Sprintf("password must be at least %d characters", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		// nothing else is worth checking on an oversized password
+		return append(violations, Violation{CodeTooLong,
+			fmt.Sprintf("password must be at most %d characters", p.MaxLength)}), nil
+	}
+	if length >= p.MinLength && Entropy(password) < p.MinEntropy {
+		violations = append(violations, Violation{CodeTooPredictable,
+			"password is too predictable, try a longer passphrase or add more variety"})
+	}
+	if containsPersonal(password, personal) {
+		violations = append(violations, Violation{CodePersonalInfo,
+			"password must not contain your email address or handle"})
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := IsBreached(ctx, p.Breached, password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, Violation{CodeBreached,
+				"password has appeared in a data breach, please choose another"})
+		}
+	}
+	return violations, nil
+}
+
+// Entropy estimates the strength of password in bits: each character is
+// worth log2 of the size of the character classes the password draws from,
+// except that repeats and runs like "aaa" or "123" only count one bit each.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, c := range password {
+		switch {
+		case c < utf8.RuneSelf && unicode.IsLower(c):
+			lower = true
+		case c < utf8.RuneSelf && unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		case c < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+
+	bits := 0.0
+	prev := rune(-1)
+	for _, c := range password {
+		if d := c - prev; d >= -1 && d <= 1 {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = c
+	}
+	return bits
+}
+
+// containsPersonal reports whether password contains any of the personal
+// details, or the local part of an email among them. Very short details
+// are ignored, they would match too much by accident.
+func containsPersonal(password string, personal []string) bool {
+	lowered := strings.ToLower(password)
+	for _, detail := range personal {
+		detail = strings.ToLower(detail)
+		candidates := []string{detail}
+		if local, _, ok := strings.Cut(detail, "@"); ok {
+			candidates = append(candidates, local)
+		}
+		if slices.ContainsFunc(candidates, func(s string) bool {
+			return utf8.RuneCountInString(s) >= 4 && strings.Contains(lowered, s)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ranges answers k-anonymity range queries: given the first five hex digits
+// of a password's SHA-1, it returns the remaining 35 digits of every
+// breached hash with that prefix. It's the shape of the Pwned Passwords
+// range API, so an online source could replace the bundled list without
+// the full hash ever leaving the server.
+type Ranges interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// IsBreached looks password up in ranges.
+func IsBreached(ctx context.Context, ranges Ranges, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := ranges.Range(ctx, hash[:5])
+	if err != nil {
+		return false, fmt.Errorf("looking up breached passwords: %w", err)
+	}
+	return slices.Contains(suffixes, hash[5:]), nil
+}
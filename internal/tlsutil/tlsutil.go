@@ -0,0 +1,151 @@
+// Package tlsutil serves chirpy over TLS: certificates that are reloaded when
+// they change on disk, the plain HTTP redirect listener and HSTS.
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reloader serves a certificate pair from disk and picks up renewed files
+// (from certbot, cert-manager, ...) without a restart.
+type Reloader struct {
+	logger   *zap.SugaredLogger
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader loads the pair straight away so a bad certificate fails
+// startup rather than the first handshake.
+func NewReloader(logger *zap.SugaredLogger, certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{logger: logger, certFile: certFile, keyFile: keyFile, interval: interval}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Run checks the files every interval until ctx is cancelled. A pair that
+// fails to load is logged and the previous certificate stays in use.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reload()
+		if err != nil {
+			r.logger.Warnw("reloading tls certificate", "cert_file", r.certFile, "error", err)
+			continue
+		}
+		if reloaded {
+			r.logger.Infow("reloaded tls certificate", "cert_file", r.certFile)
+		}
+	}
+}
+
+func (r *Reloader) reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading key pair: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return true, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Config returns the server TLS config for certificates served by r.
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// RedirectHandler sends every plain HTTP request to the same URL on the
+// HTTPS listener at httpsAddr.
+func RedirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// HSTS tells browsers to only ever reach us over HTTPS for maxAge. The header
+// is only set on TLS requests, as the spec requires.
+func HSTS(maxAge time.Duration) func(http.Handler) http.Handler {
+	value := "max-age=" + strconv.Itoa(int(maxAge.Seconds())) + "; includeSubDomains"
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,32 +2,40 @@ package main
 
 import (
 	"chirpy/internal/api"
+	"chirpy/internal/auth"
+	"chirpy/internal/config"
 	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"chirpy/internal/httpsec"
+	"chirpy/internal/jobs"
+	"chirpy/internal/lifecycle"
+	"chirpy/internal/mail"
+	"chirpy/internal/metrics"
+	"chirpy/internal/migrate"
+	"chirpy/internal/oidc"
+	"chirpy/internal/preview"
+	"chirpy/internal/pwpolicy"
+	"chirpy/internal/tlsutil"
+	"chirpy/internal/tracing"
+	"chirpy/sql/schema"
 	"context"
-	"database/sql"
+	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
-	"os/signal"
-	"sync/atomic"
+	"strings"
 	"time"
 
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
-type Config struct {
-	ListenAddr     string
-	ReadTimeout    time.Duration
-	WriteTimeout   time.Duration
-	IdleTimeout    time.Duration
-	MaxHeaderBytes int
-}
-
 type Server struct {
-	Config
-	router *http.ServeMux
-	logger *zap.SugaredLogger
+	config.ServerConfig
+	router      *http.ServeMux
+	middlewares []func(http.Handler) http.Handler
 }
 
 func initLogger() (*zap.SugaredLogger, error) {
@@ -40,96 +48,322 @@ func initLogger() (*zap.SugaredLogger, error) {
 	return logger.Sugar(), nil
 }
 
-func NewServer(cfg Config, logger zap.SugaredLogger) *Server {
+func NewServer(cfg config.ServerConfig) *Server {
 	return &Server{
-		Config: cfg,
-		router: http.NewServeMux(),
-		logger: &logger,
+		ServerConfig: cfg,
+		router:       http.NewServeMux(),
 	}
 }
 
-func (s *Server) Start() error {
-	server := &http.Server{
+// Use wraps the router in middlewares. The first one registered is the
+// outermost, so it sees the request first.
+func (s *Server) Use(middlewares ...func(http.Handler) http.Handler) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// HTTPServer builds the http.Server for the router and its middlewares.
+func (s *Server) HTTPServer() *http.Server {
+	var handler http.Handler = s.router
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		handler = s.middlewares[i](handler)
+	}
+
+	return &http.Server{
 		Addr:           s.ListenAddr,
-		Handler:        s.router,
+		Handler:        handler,
 		ReadTimeout:    s.ReadTimeout,
 		WriteTimeout:   s.WriteTimeout,
 		IdleTimeout:    s.IdleTimeout,
 		MaxHeaderBytes: s.MaxHeaderBytes,
 	}
+}
 
-	go func() {
-		s.logger.Info("Starting server on port ", s.ListenAddr)
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			s.logger.Fatal("Server failed: ", err)
-		}
-	}()
+func main() {
+	logger, err := initLogger()
+	if err != nil {
+		panic("initializing logger")
+	}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	if err := run(logger, os.Args[1:]); err != nil {
+		logger.Fatal(err)
+	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// runServe implements `chirpy serve`, which is also what runs when no
+// command is given.
+func runServe(logger *zap.SugaredLogger, args []string) error {
+	conf, err := config.Load(args)
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
 
-	return server.Shutdown(ctx)
-}
+	db, err := openDB(conf.Database)
+	if err != nil {
+		return err
+	}
+	lc := lifecycle.New(logger, conf.Server.DrainDelay, conf.Server.ShutdownTimeout)
+	lc.OnClose("database", func(context.Context) error { return db.Close() })
+	metrics.RegisterDBStats(db, "chirpy")
+	dbQueries := database.New(tracing.InstrumentDB(metrics.InstrumentDB(db)))
 
-func handlerHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    conf.Tracing.Exporter,
+		ServiceName: conf.Tracing.ServiceName,
+	})
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	lc.OnClose("tracing", shutdownTracing)
 
-func main() {
-	godotenv.Load()
+	// sql.Open doesn't connect; check now so a bad DB_URL shows up in the
+	// logs straight away. Readiness keeps checking after this.
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := db.PingContext(pingCtx); err != nil {
+		logger.Warnw("database is not reachable", "error", err)
+	}
+	cancelPing()
+
+	migrator, err := migrate.New(db, schema.FS)
+	if err != nil {
+		return fmt.Errorf("loading migrations: %w", err)
+	}
+	if conf.Database.AutoMigrate {
+		migrator.Logf = logger.Infof
+		if err := migrator.Up(context.Background()); err != nil {
+			return fmt.Errorf("migrating database: %w", err)
+		}
+	}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	previews := preview.NewService(logger, preview.NewFetcher(preview.FetcherConfig{
+		Timeout:      conf.Previews.FetchTimeout,
+		AllowPrivate: conf.Previews.AllowPrivate,
+	}), dbQueries, conf.Previews.CacheTTL)
+
+	providers := map[string]*oidc.Provider{}
+	for name, p := range conf.OIDC.Providers {
+		providers[name] = oidc.NewProvider(oidc.Config{
+			Name:         name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		})
+	}
+
+	policy, err := passwordPolicy(conf.Auth.Password)
 	if err != nil {
-		panic("intializing postgres db connection")
+		return err
 	}
-	dbQueries := database.New(db)
 
-	cfg := Config{
-		ListenAddr:     ":8080",
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		IdleTimeout:    30 * time.Second,
-		MaxHeaderBytes: 1 << 20, // 1mb
+	trustedProxies := []netip.Prefix{}
+	for _, cidr := range conf.Server.TrustedProxies {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return fmt.Errorf("parsing trusted proxy: %w", err)
+		}
+		trustedProxies = append(trustedProxies, prefix.Masked())
 	}
+
 	apiCfg := api.Config{
-		FileserverHits:   atomic.Int32{},
+		DB:               db,
 		DbQueries:        dbQueries,
-		Platform:         os.Getenv("PLATFORM"),
-		JwtSigningSecret: os.Getenv("JWT_SIGNING_KEY"),
-		PolkaKey:         os.Getenv("POLKA_KEY"),
+		Platform:         conf.Platform,
+		JwtSigningSecret: conf.Auth.JWTSigningKey,
+		PolkaKey:         conf.Auth.PolkaKey,
+		AdminKey:         conf.Auth.AdminKey,
+		AccessTokenTTL:   conf.Auth.AccessTokenTTL,
+		RefreshTokenTTL:  conf.Auth.RefreshTokenTTL,
+		CookieSessions:   conf.Auth.CookieSessions,
+		OIDC:             providers,
+		Passwords:        passwordHasher(conf.Auth.Password),
+		PasswordPolicy:   policy,
+		Mailer:           mailer(conf.Mail, logger),
+		LinkBaseURL:      strings.TrimSuffix(conf.Mail.LinkBaseURL, "/"),
+		MaxChirpLength:   conf.Chirps.MaxLength,
+		MaxScheduleAhead: conf.Chirps.MaxScheduleAhead,
+		RestoreWindow:    conf.Chirps.RestoreWindow,
+		Previews:         previews,
+		Logger:           logger,
+		TrustedProxies:   trustedProxies,
 	}
 
-	logger, err := initLogger()
-	if err != nil {
-		panic("initializing logger")
+	scheduler := jobs.NewChirpScheduler(logger, db, dbQueries, conf.Chirps.ScheduleInterval)
+	scheduler.OnPublish = func(chirp database.Chirp) {
+		previews.Enqueue(preview.FirstURL(chirp.Body))
 	}
 
-	server := NewServer(cfg, *logger)
+	purger := jobs.NewPurger(logger, dbQueries, conf.Chirps.PurgeInterval, conf.Chirps.Retention)
+
+	// a worker counts as stuck once it has missed a couple of rounds
+	previews.Heartbeat = health.NewHeartbeat("previews", 4*preview.HeartbeatInterval)
+	scheduler.Heartbeat = health.NewHeartbeat("scheduler", 4*conf.Chirps.ScheduleInterval)
+	purger.Heartbeat = health.NewHeartbeat("purger", 2*conf.Chirps.PurgeInterval+5*time.Minute)
+
+	checker := health.NewChecker(db, migrator.Latest(), conf.Database.PingTimeout)
+	checker.Watch(previews.Heartbeat, scheduler.Heartbeat, purger.Heartbeat)
+
+	lc.Go("previews", previews.Run)
+	lc.Go("scheduler", scheduler.Run)
+	lc.Go("purger", purger.Run)
+	lc.OnDrain(checker.Drain)
+
+	server := NewServer(conf.Server)
+	if conf.Server.TLS.Enabled() && conf.Server.TLS.HSTSMaxAge > 0 {
+		server.Use(tlsutil.HSTS(conf.Server.TLS.HSTSMaxAge))
+	}
+	server.Use(tracing.Middleware, apiCfg.MiddlewareLogging, metrics.Middleware, tracing.RecordRoute)
+	server.Use(httpsec.Headers(httpsec.HeadersConfig{
+		ContentSecurityPolicy: conf.Headers.ContentSecurityPolicy,
+		FrameOptions:          conf.Headers.FrameOptions,
+		ReferrerPolicy:        conf.Headers.ReferrerPolicy,
+	}))
+	// CORS runs inside the logging and metrics middlewares so preflights
+	// show up in both.
+	server.Use(httpsec.CORS(httpsec.CORSConfig{
+		AllowedOrigins:   conf.CORS.AllowedOrigins,
+		AllowedHeaders:   conf.CORS.AllowedHeaders,
+		ExposedHeaders:   []string{"X-Request-ID", "Location"},
+		AllowCredentials: conf.CORS.AllowCredentials,
+		MaxAge:           conf.CORS.MaxAge,
+	}))
+	if conf.Auth.CookieSessions {
+		server.Use(apiCfg.MiddlewareCSRF)
+	}
 	server.router.Handle("GET /app/", apiCfg.MiddlewareMetrics(http.StripPrefix(
 		"/app", http.FileServer(http.Dir(".")))))
 	server.router.Handle("GET /assets", http.FileServer(http.Dir("./assets")))
-	server.router.Handle("GET /api/healthz", http.HandlerFunc(handlerHealth))
+	server.router.Handle("GET /livez", http.HandlerFunc(checker.Livez))
+	server.router.Handle("GET /readyz", http.HandlerFunc(checker.Readyz))
+	server.router.Handle("GET /api/healthz", http.HandlerFunc(checker.Readyz))
 	server.router.Handle("POST /api/users", http.HandlerFunc(apiCfg.CreateUser))
 	server.router.Handle("PUT /api/users", http.HandlerFunc(apiCfg.UpdateUserLogin))
+	server.router.Handle("PATCH /api/users/me", http.HandlerFunc(apiCfg.UpdateCurrentUser))
+	server.router.Handle("POST /api/users/me/password", http.HandlerFunc(apiCfg.ChangePassword))
+	server.router.Handle("POST /api/users/me/email", http.HandlerFunc(apiCfg.RequestEmailChange))
+	server.router.Handle("POST /api/users/email/confirm", http.HandlerFunc(apiCfg.ConfirmEmailChange))
+	server.router.Handle("DELETE /api/users/me", http.HandlerFunc(apiCfg.DeleteCurrentUser))
+	server.router.Handle("GET /api/users/me/export", http.HandlerFunc(apiCfg.ExportCurrentUser))
+	server.router.Handle("GET /api/users/me/security-events", http.HandlerFunc(apiCfg.ListSecurityEvents))
+	server.router.Handle("GET /api/users/{handle}", http.HandlerFunc(apiCfg.GetUserProfile))
 	server.router.Handle("POST /api/login", http.HandlerFunc(apiCfg.Login))
 	server.router.Handle("POST /api/refresh", http.HandlerFunc(apiCfg.Refresh))
 	server.router.Handle("POST /api/revoke", http.HandlerFunc(apiCfg.Revoke))
+	server.router.Handle("POST /api/tokens", http.HandlerFunc(apiCfg.CreatePersonalAccessToken))
+	server.router.Handle("GET /api/tokens", http.HandlerFunc(apiCfg.ListPersonalAccessTokens))
+	server.router.Handle("DELETE /api/tokens/{tokenID}", http.HandlerFunc(apiCfg.RevokePersonalAccessToken))
+	server.router.Handle("GET /api/auth/{provider}/login", http.HandlerFunc(apiCfg.OIDCLogin))
+	server.router.Handle("GET /api/auth/{provider}/callback", http.HandlerFunc(apiCfg.OIDCCallback))
 	server.router.Handle("POST /api/chirps", http.HandlerFunc(apiCfg.CreateChirp))
 	server.router.Handle("GET /api/chirps", http.HandlerFunc(apiCfg.ListChirps))
+	server.router.Handle("GET /api/chirps/scheduled", http.HandlerFunc(apiCfg.ListScheduledChirps))
+	server.router.Handle("DELETE /api/chirps/scheduled/{chirpID}", http.HandlerFunc(apiCfg.CancelScheduledChirp))
 	server.router.Handle("GET /api/chirps/{chirpID}", http.HandlerFunc(apiCfg.GetChirp))
 	server.router.Handle("DELETE /api/chirps/{chirpID}", http.HandlerFunc(apiCfg.DeleteChirp))
+	server.router.Handle("POST /api/chirps/{chirpID}/restore", http.HandlerFunc(apiCfg.RestoreChirp))
 	server.router.Handle("POST /api/polka/webhooks", http.HandlerFunc(apiCfg.UpgradeUser))
-	server.router.Handle("POST /admin/reset", http.HandlerFunc(apiCfg.ResetHitsAndUsers))
-	server.router.Handle("GET /admin/metrics", http.HandlerFunc(apiCfg.PageHits))
+	server.router.Handle("POST /admin/reset", http.HandlerFunc(apiCfg.ResetUsers))
+	server.router.Handle("GET /admin/health", apiCfg.RequireAdmin(http.HandlerFunc(checker.Detail)))
+	server.router.Handle("GET /admin/audit", apiCfg.RequireAdmin(http.HandlerFunc(apiCfg.ListAuditEvents)))
+	if conf.Metrics.ListenAddr == "" {
+		server.router.Handle("GET /metrics", apiCfg.RequireAdmin(metrics.Handler()))
+	}
+
+	if err := listen(logger, lc, server, conf.Server.TLS); err != nil {
+		return err
+	}
+	if conf.Metrics.ListenAddr != "" {
+		internal := http.NewServeMux()
+		internal.Handle("GET /metrics", metrics.Handler())
+		metricsServer := &http.Server{
+			Addr:              conf.Metrics.ListenAddr,
+			Handler:           internal,
+			ReadHeaderTimeout: conf.Server.ReadTimeout,
+			IdleTimeout:       conf.Server.IdleTimeout,
+		}
+		lc.Serve(metricsServer, metricsServer.ListenAndServe)
+	}
+	return lc.Run(context.Background())
+}
+
+// listen registers the HTTP servers with lc: plain HTTP (optionally with
+// h2c), or HTTPS plus the redirect listener when TLS is configured. Go's TLS
+// server negotiates HTTP/2 on its own.
+func listen(logger *zap.SugaredLogger, lc *lifecycle.Manager, server *Server, conf config.TLSConfig) error {
+	httpServer := server.HTTPServer()
+
+	if !conf.Enabled() {
+		if conf.H2C {
+			httpServer.Handler = h2c.NewHandler(httpServer.Handler, &http2.Server{
+				IdleTimeout: server.IdleTimeout,
+			})
+		}
+		lc.Serve(httpServer, httpServer.ListenAndServe)
+		return nil
+	}
 
-	if err := server.Start(); err != nil {
-		logger.Fatal("starting server")
+	certs, err := tlsutil.NewReloader(logger, conf.CertFile, conf.KeyFile, conf.ReloadInterval)
+	if err != nil {
+		return fmt.Errorf("loading tls certificate: %w", err)
+	}
+	lc.Go("tls-reload", certs.Run)
+
+	httpServer.TLSConfig = certs.Config()
+	lc.Serve(httpServer, func() error { return httpServer.ListenAndServeTLS("", "") })
+
+	if conf.RedirectAddr != "" {
+		redirect := &http.Server{
+			Addr:              conf.RedirectAddr,
+			Handler:           tlsutil.RedirectHandler(server.ListenAddr),
+			ReadHeaderTimeout: server.ReadTimeout,
+			IdleTimeout:       server.IdleTimeout,
+		}
+		lc.Serve(redirect, redirect.ListenAndServe)
+	}
+	return nil
+}
+
+func passwordHasher(conf config.PasswordConfig) auth.PasswordHasher {
+	return auth.PasswordHasher{Params: auth.PasswordParams{
+		Memory:      uint32(conf.MemoryKiB),
+		Iterations:  uint32(conf.Iterations),
+		Parallelism: uint8(conf.Parallelism),
+	}}
+}
+
+// passwordPolicy builds the policy for new passwords. 256 characters is far
+// beyond any passphrase and keeps hashing cost bounded.
+func passwordPolicy(conf config.PasswordConfig) (pwpolicy.Policy, error) {
+	policy := pwpolicy.Policy{
+		MinLength:  conf.MinLength,
+		MaxLength:  256,
+		MinEntropy: float64(conf.MinEntropyBits),
+	}
+	if !conf.CheckBreached {
+		return policy, nil
+	}
+	if conf.BreachedList == "" {
+		policy.Breached = pwpolicy.Bundled()
+		return policy, nil
+	}
+	breached, err := pwpolicy.OpenSortedFile(conf.BreachedList)
+	if err != nil {
+		return pwpolicy.Policy{}, fmt.Errorf("loading breached password list: %w", err)
+	}
+	policy.Breached = breached
+	return policy, nil
+}
+
+// mailer sends through SMTP when it is configured, and otherwise only logs
+// messages so links can be followed by hand in development.
+func mailer(conf config.MailConfig, logger *zap.SugaredLogger) mail.Sender {
+	if conf.SMTPAddr == "" {
+		return mail.LogSender{Logf: logger.Infof}
+	}
+	return mail.SMTPSender{
+		Addr:     conf.SMTPAddr,
+		From:     conf.From,
+		Username: conf.SMTPUsername,
+		Password: conf.SMTPPassword,
 	}
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"chirpy/internal/config"
+	"chirpy/internal/migrate"
+	"chirpy/sql/schema"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const migrateUsage = "usage: chirpy migrate up|down|status|redo [flags]"
+
+// runMigrate implements `chirpy migrate`. args are the arguments following
+// "migrate".
+func runMigrate(logger *zap.SugaredLogger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	command := args[0]
+
+	conf, err := config.LoadCLI(args[1:])
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+	db, err := openDB(conf.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, schema.FS)
+	if err != nil {
+		return err
+	}
+	migrator.Logf = logger.Infof
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx)
+	case "redo":
+		return migrator.Redo(ctx)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "APPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", appliedAt, s.Name)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown migrate command %q\n%s", command, migrateUsage)
+}
+
+func openDB(conf config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("intializing postgres db connection: %w", err)
+	}
+	db.SetMaxOpenConns(conf.MaxOpenConns)
+	db.SetMaxIdleConns(conf.MaxIdleConns)
+	db.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
+	return db, nil
+}
@@ -0,0 +1,26 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (created_at, action, outcome, actor_id, subject_id, target, ip, user_agent, request_id, details)
+VALUES (
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+);
+
+-- name: ListAuditEvents :many
+SELECT *
+FROM audit_events
+WHERE (sqlc.narg('action')::text IS NULL OR action = sqlc.narg('action'))
+    AND (sqlc.narg('outcome')::text IS NULL OR outcome = sqlc.narg('outcome'))
+    AND (sqlc.narg('actor_id')::uuid IS NULL OR actor_id = sqlc.narg('actor_id'))
+    AND (sqlc.narg('subject_id')::uuid IS NULL OR subject_id = sqlc.narg('subject_id'))
+    AND (sqlc.narg('since')::timestamptz IS NULL OR created_at >= sqlc.narg('since'))
+    AND (sqlc.narg('before_id')::bigint IS NULL OR id < sqlc.narg('before_id'))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit');
@@ -12,11 +12,33 @@ VALUES (
 -- name: FindRefreshToken :one
 SELECT *
 FROM refresh_tokens
-WHERE token = $1;
+WHERE token = $1 AND EXISTS (
+    SELECT 1
+    FROM users
+    WHERE users.id = refresh_tokens.user_id AND users.deleted_at IS NULL
+);
 
 -- name: UpdateRefreshToken :exec
 UPDATE refresh_tokens
 SET
     revoked_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC' 
-WHERE token = $1;
\ No newline at end of file
+WHERE token = $1;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+
+-- name: ListRefreshTokensForUser :many
+SELECT *
+FROM refresh_tokens
+WHERE user_id = $1 AND EXISTS (
+    SELECT 1
+    FROM users
+    WHERE users.id = refresh_tokens.user_id AND users.deleted_at IS NULL
+)
+ORDER BY created_at ASC;
@@ -1,11 +1,13 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at, published_at)
 VALUES (
     gen_random_uuid(),
     CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
 RETURNING *;
 
@@ -13,22 +15,110 @@ RETURNING *;
 -- name: ListChirps :many
 SELECT * 
 FROM chirps
-ORDER BY created_at DESC;
+WHERE published_at IS NOT NULL AND deleted_at IS NULL
+ORDER BY published_at DESC;
 
 
 -- name: ListChirpsByAuthor :many
 SELECT *
 FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+WHERE user_id = $1 AND published_at IS NOT NULL AND deleted_at IS NULL
+ORDER BY published_at ASC;
 
 
 -- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT *
 FROM chirps 
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
 
 -- name: DeleteChirp :exec
+UPDATE chirps
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    deleted_by = $2,
+    deleted_by_role = $3
+WHERE id = $1 AND deleted_at IS NULL;
+
+
+-- name: DeleteAllChirps :exec
+UPDATE chirps
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE deleted_at IS NULL;
+
+
+-- name: GetDeletedChirp :one
+SELECT *
+FROM chirps
+WHERE id = $1 AND deleted_at IS NOT NULL;
+
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET
+    deleted_at = NULL,
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    deleted_by = NULL,
+    deleted_by_role = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING *;
+
+
+-- name: PurgeDeletedChirps :execrows
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE deleted_at < $1;
+
+
+-- name: ListScheduledChirps :many
+SELECT *
+FROM chirps
+WHERE user_id = $1 AND published_at IS NULL AND deleted_at IS NULL
+ORDER BY publish_at ASC;
+
+
+-- name: CancelScheduledChirp :execrows
+UPDATE chirps
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    deleted_by = user_id,
+    deleted_by_role = 'user'
+WHERE id = $1 AND user_id = $2 AND published_at IS NULL AND deleted_at IS NULL;
+
+
+-- name: ClaimDueChirps :many
+SELECT *
+FROM chirps
+WHERE published_at IS NULL AND publish_at <= $1 AND deleted_at IS NULL
+ORDER BY publish_at ASC
+LIMIT $2
+FOR UPDATE SKIP LOCKED;
+
+
+-- name: PublishChirp :one
+UPDATE chirps
+SET
+    published_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE id = $1 AND published_at IS NULL AND deleted_at IS NULL
+RETURNING *;
+
+
+-- name: DeleteChirpsByUser :exec
+UPDATE chirps
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    deleted_by = user_id,
+    deleted_by_role = 'user'
+WHERE user_id = $1 AND deleted_at IS NULL;
+
+
+-- name: ListAllChirpsByUser :many
+SELECT *
+FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
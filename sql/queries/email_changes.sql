@@ -0,0 +1,31 @@
+-- name: CreateEmailChange :one
+INSERT INTO email_changes (id, created_at, user_id, new_email, token_hash, expires_at)
+VALUES (
+    gen_random_uuid(),
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id) DO UPDATE
+SET
+    id = EXCLUDED.id,
+    created_at = EXCLUDED.created_at,
+    new_email = EXCLUDED.new_email,
+    token_hash = EXCLUDED.token_hash,
+    expires_at = EXCLUDED.expires_at
+RETURNING *;
+
+-- name: FindEmailChangeByHash :one
+SELECT *
+FROM email_changes
+WHERE token_hash = $1;
+
+-- name: DeleteEmailChange :exec
+DELETE FROM email_changes
+WHERE id = $1;
+
+-- name: DeleteEmailChangesByUser :exec
+DELETE FROM email_changes
+WHERE user_id = $1;
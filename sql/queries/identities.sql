@@ -0,0 +1,34 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (provider, subject, created_at, updated_at, user_id, email, last_login_at)
+VALUES (
+    $1,
+    $2,
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    $3,
+    $4,
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+);
+
+-- name: FindUserIdentity :one
+SELECT *
+FROM user_identities
+WHERE provider = $1 AND subject = $2;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET
+    email = $3,
+    last_login_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE provider = $1 AND subject = $2;
+
+-- name: ListUserIdentities :many
+SELECT *
+FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: DeleteUserIdentitiesByUser :exec
+DELETE FROM user_identities
+WHERE user_id = $1;
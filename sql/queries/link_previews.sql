@@ -0,0 +1,34 @@
+-- name: UpsertLinkPreview :exec
+INSERT INTO link_previews (url, created_at, updated_at, title, description, image_url, site_name, fetch_error, fetched_at)
+VALUES (
+    $1,
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+)
+ON CONFLICT (url) DO UPDATE
+SET
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    image_url = EXCLUDED.image_url,
+    site_name = EXCLUDED.site_name,
+    fetch_error = EXCLUDED.fetch_error,
+    fetched_at = EXCLUDED.fetched_at;
+
+
+-- name: GetLinkPreview :one
+SELECT *
+FROM link_previews
+WHERE url = $1;
+
+
+-- name: ListLinkPreviews :many
+SELECT *
+FROM link_previews
+WHERE url = ANY($1::text[]);
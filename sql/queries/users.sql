@@ -1,42 +1,129 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle, display_name, bio, avatar_url)
 VALUES (
     gen_random_uuid(),
     CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
 )
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, avatar_url;
 
 
 -- name: DeleteAllUsers :exec
-DELETE FROM users;
+UPDATE users
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE deleted_at IS NULL;
 
 
 -- name: FindUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT *
 FROM users
-WHERE email = $1;
+WHERE email = $1 AND deleted_at IS NULL;
 
 
 -- name: FindUserById :one
 SELECT *
 FROM users
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
+
+
+-- name: UpdateUserEmail :one
+UPDATE users
+SET
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    email = $2
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, avatar_url;
+
 
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    hashed_password = $2
+WHERE id = $1 AND deleted_at IS NULL;
 
--- name: UpdateUserLogin :one
+
+-- name: UpdateUserProfile :one
 UPDATE users
 SET
     updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
-    email = $2,
-    hashed_password = $3
-WHERE id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+    handle = $2,
+    display_name = $3,
+    bio = $4,
+    avatar_url = $5
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, avatar_url;
 
 
--- name: UpgradeUser :exec
+-- name: UpgradeUser :execrows
 UPDATE users
 SET is_chirpy_red = TRUE
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1 AND deleted_at IS NULL;
+
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at < $1;
+
+
+-- name: DeleteUser :exec
+UPDATE users
+SET
+    deleted_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE id = $1 AND deleted_at IS NULL;
+
+
+
+-- name: GetUserProfile :one
+SELECT
+    users.id,
+    users.created_at,
+    users.handle,
+    users.display_name,
+    users.bio,
+    users.avatar_url,
+    (
+        SELECT count(*)
+        FROM chirps
+        WHERE chirps.user_id = users.id
+            AND chirps.published_at IS NOT NULL
+            AND chirps.deleted_at IS NULL
+    ) AS chirp_count
+FROM users
+WHERE users.handle = $1 AND users.deleted_at IS NULL;
+
+
+-- name: ListUserSummaries :many
+SELECT id, handle, display_name, avatar_url
+FROM users
+WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL;
+
+-- name: SetUserRole :execrows
+UPDATE users
+SET
+    role = $2,
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE id = $1 AND deleted_at IS NULL;
+
+
+-- name: DisableUser :execrows
+UPDATE users
+SET
+    disabled_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC',
+    updated_at = CURRENT_TIMESTAMP AT TIME ZONE 'UTC'
+WHERE id = $1 AND deleted_at IS NULL AND disabled_at IS NULL;
+
+
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = $2
+WHERE id = $1 AND hashed_password = $3;
@@ -9,4 +9,4 @@ CREATE TABLE refresh_tokens (
 );
 
 -- +goose Down
-DROP TABLE refesh_tokens;
\ No newline at end of file
+DROP TABLE refresh_tokens;
\ No newline at end of file
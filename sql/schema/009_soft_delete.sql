@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE chirps
+ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- a deleted account shouldn't block someone from signing up with its email
+ALTER TABLE users
+DROP CONSTRAINT users_email_key;
+
+CREATE UNIQUE INDEX users_email_active_idx ON users (email)
+WHERE deleted_at IS NULL;
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at)
+WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX chirps_deleted_at_idx ON chirps (deleted_at)
+WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_deleted_at_idx;
+DROP INDEX users_deleted_at_idx;
+DROP INDEX users_email_active_idx;
+
+DELETE FROM chirps WHERE deleted_at IS NOT NULL;
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE users
+ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE chirps
+DROP COLUMN deleted_at;
+
+ALTER TABLE users
+DROP COLUMN deleted_at;
@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT,
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+
+-- existing accounts get a placeholder handle they can change later
+UPDATE users
+SET handle = 'user_' || substr(replace(id::text, '-', ''), 1, 12)
+WHERE handle IS NULL;
+
+ALTER TABLE users
+ALTER COLUMN handle SET NOT NULL;
+
+CREATE UNIQUE INDEX users_handle_active_idx ON users (handle)
+WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX users_handle_active_idx;
+
+ALTER TABLE users
+DROP COLUMN avatar_url,
+DROP COLUMN bio,
+DROP COLUMN display_name,
+DROP COLUMN handle;
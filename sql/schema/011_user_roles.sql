@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'admin')),
+ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN disabled_at,
+DROP COLUMN role;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- audit_events has no foreign keys on purpose: the trail must outlive the
+-- users and chirps it mentions.
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    action TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    actor_id UUID,
+    subject_id UUID,
+    target TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    details TEXT NOT NULL
+);
+
+CREATE INDEX audit_events_subject_id_idx ON audit_events (subject_id, id);
+CREATE INDEX audit_events_action_idx ON audit_events (action, id);
+
+-- append-only: the application can add events but never rewrite history
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only();
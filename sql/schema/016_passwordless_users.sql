@@ -0,0 +1,22 @@
+-- +goose Up
+-- users who only ever signed in with an identity provider have no password
+ALTER TABLE users ALTER COLUMN hashed_password DROP NOT NULL;
+
+-- social sign-ups used to get a random password nobody knows; they are the
+-- users created in the same transaction as their first identity
+UPDATE users
+SET hashed_password = NULL
+WHERE EXISTS (
+    SELECT 1
+    FROM user_identities
+    WHERE user_identities.user_id = users.id
+        AND user_identities.created_at = users.created_at
+);
+
+-- +goose Down
+-- no hash matches '!', so these accounts stay unusable with a password
+UPDATE users
+SET hashed_password = '!'
+WHERE hashed_password IS NULL;
+
+ALTER TABLE users ALTER COLUMN hashed_password SET NOT NULL;
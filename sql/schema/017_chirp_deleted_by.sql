@@ -0,0 +1,29 @@
+-- +goose Up
+-- who deleted a chirp, and in which role, decides who may restore it: an
+-- admin takedown must not be undone by the author
+ALTER TABLE chirps
+ADD COLUMN deleted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN deleted_by_role TEXT
+    CHECK (deleted_by_role IN ('user', 'admin'));
+
+UPDATE chirps
+SET
+    deleted_by = user_id,
+    deleted_by_role = 'user'
+WHERE deleted_at IS NOT NULL;
+
+-- takedowns before this migration are only known from the audit log
+UPDATE chirps
+SET
+    deleted_by = audit_events.actor_id,
+    deleted_by_role = 'admin'
+FROM audit_events
+WHERE chirps.deleted_at IS NOT NULL
+    AND audit_events.action = 'moderation.chirp_delete'
+    AND audit_events.outcome = 'success'
+    AND audit_events.target = chirps.id::text;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN deleted_by_role,
+DROP COLUMN deleted_by;